@@ -1,6 +1,13 @@
 #!/bin/sh
 
+# Explo keeps running with the built-in scheduler or HTTP API (SCHEDULE or HTTP_ADDR, set by compose or in .env) and handles SIGTERM itself,
+# yt-dlp is upgraded before each run. Cron would start a second instance next to it
+if [ -n "$SCHEDULE" ] || [ -n "$HTTP_ADDR" ] || grep -qE "^[[:space:]]*(SCHEDULE|HTTP_ADDR)=[[:space:]]*[\"']?[^[:space:]#\"']" /opt/explo/.env 2>/dev/null; then
+    export YTDLP_UPDATE="${YTDLP_UPDATE-apk add --upgrade yt-dlp}"
+    cd /opt/explo && exec ./explo
+fi
+
 # Cron schedule is set by compose or build files
 echo "$CRON_SCHEDULE apk add --upgrade yt-dlp && cd /opt/explo && ./explo >> /proc/1/fd/1 2>&1" > /etc/crontabs/root
 
-crond -f -l 2
\ No newline at end of file
+crond -f -l 2
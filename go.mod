@@ -6,8 +6,10 @@ toolchain go1.24.3
 
 require (
 	github.com/ilyakaznacheev/cleanenv v1.5.0
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/u2takey/ffmpeg-go v0.5.0
 	github.com/wader/goutubedl v0.0.0-20250417150709-083444e4ab87
+	go.etcd.io/bbolt v1.4.3
 	golang.org/x/sync v0.15.0
 )
 
@@ -17,6 +19,7 @@ require (
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
 	github.com/joho/godotenv v1.5.1 // indirect
 	github.com/u2takey/go-utils v0.3.1 // indirect
+	golang.org/x/sys v0.29.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	olympos.io/encoding/edn v0.0.0-20201019073823-d3554ca0b0a3 // indirect
 )
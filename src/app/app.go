@@ -0,0 +1,115 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	"explo/src/config"
+	"explo/src/store"
+	"explo/src/util"
+)
+
+var ErrRunning = errors.New("a run is already in progress")
+
+// App runs the discover, download and playlist pipeline, one run at a time
+type App struct {
+	cfg        *config.Config
+	httpClient *util.HttpClient
+	State      *store.Store
+	running    sync.Mutex // held during a run, so runs never overlap
+	runs       sync.WaitGroup
+	mu         sync.Mutex // guards current, cancel and review
+	current    uint64
+	cancel     context.CancelFunc
+	review     *Review
+}
+
+func New(cfg *config.Config, httpClient *util.HttpClient, state *store.Store) *App {
+	return &App{
+		cfg:        cfg,
+		httpClient: httpClient,
+		State:      state,
+	}
+}
+
+func (a *App) Run(ctx context.Context) error { // explore and wait for the run to finish
+	run, runCtx, err := a.begin(ctx)
+	if err != nil {
+		return err
+	}
+	return a.execute(runCtx, run)
+}
+
+func (a *App) Start() (uint64, error) { // explore in the background, returns the ID of the started run
+	run, runCtx, err := a.begin(context.Background())
+	if err != nil {
+		return 0, err
+	}
+
+	go func() {
+		if err := a.execute(runCtx, run); err != nil {
+			log.Printf("run %d failed: %s", run.ID, err.Error())
+		}
+	}()
+	return run.ID, nil
+}
+
+func (a *App) Cancel() bool { // cancel the run in progress, returns false if there's none
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.cancel == nil {
+		return false
+	}
+	a.cancel()
+	return true
+}
+
+func (a *App) Current() (uint64, bool) { // ID of the run in progress
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.current, a.cancel != nil
+}
+
+func (a *App) Wait() { // wait for the run in progress to return
+	a.runs.Wait()
+}
+
+func (a *App) begin(ctx context.Context) (*store.Run, context.Context, error) {
+	if !a.running.TryLock() {
+		return nil, nil, ErrRunning
+	}
+
+	run, err := a.State.StartRun(a.cfg.System, a.cfg.DryRun)
+	if err != nil {
+		a.running.Unlock()
+		return nil, nil, err
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	a.mu.Lock()
+	a.current, a.cancel = run.ID, cancel
+	a.mu.Unlock()
+	a.runs.Add(1)
+	return run, runCtx, nil
+}
+
+func (a *App) execute(ctx context.Context, run *store.Run) error {
+	defer func() {
+		a.mu.Lock()
+		a.cancel()
+		a.current, a.cancel = 0, nil
+		a.mu.Unlock()
+		a.running.Unlock()
+		a.runs.Done()
+	}()
+
+	log.Printf("starting run %d", run.ID)
+	err := a.explore(ctx, run)
+	if ctx.Err() != nil && err == nil {
+		err = ctx.Err()
+	}
+	record(a.State.FinishRun(run, err))
+	return err
+}
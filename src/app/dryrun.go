@@ -0,0 +1,103 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"explo/src/client"
+	"explo/src/downloader"
+	"explo/src/models"
+	"explo/src/store"
+)
+
+func (a *App) dryRun(ctx context.Context, run *store.Run, users []*user, systems []*client.Client, dl *downloader.DownloadClient) error { // look up tracks and download sources, then report what a run would do
+	var playlists []*models.Playlist
+	for _, user := range users {
+		playlists = append(playlists, user.playlists...)
+	}
+	tracks := uniqueTracks(playlists)
+	checkTracks(systems, tracks)
+	record(a.State.RecordTracks(run, tracks))
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	previews := dl.PreviewDownloads(ctx, tracks)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var report strings.Builder
+	fmt.Fprintf(&report, "\n=== Dry run (%s) ===\n", a.cfg.System)
+
+	if !a.cfg.Persist {
+		liked, err := likedFiles(users)
+		switch {
+		case err != nil:
+			fmt.Fprintf(&report, "\nPERSIST=false, but no file in %s would be deleted: %s\n", a.cfg.DownloadCfg.DownloadDir, err.Error())
+		case len(liked) > 0:
+			fmt.Fprintf(&report, "\nPERSIST=false, every file in %s would be deleted except liked tracks:\n", a.cfg.DownloadCfg.DownloadDir)
+			for _, file := range liked {
+				if _, err := os.Stat(file); err == nil {
+					fmt.Fprintf(&report, "  %s\n", file)
+				}
+			}
+		default:
+			fmt.Fprintf(&report, "\nPERSIST=false, every file in %s would be deleted\n", a.cfg.DownloadCfg.DownloadDir)
+		}
+		for _, user := range users {
+			for _, c := range user.clients {
+				for _, playlist := range user.playlists {
+					if c.PlaylistExists(playlist.Name) {
+						fmt.Fprintf(&report, "Playlist %s would be deleted and created again in %s\n", playlistLabel(playlist), c.System)
+					}
+				}
+			}
+		}
+	}
+
+	if a.cfg.Persist && a.cfg.Retention() > 0 {
+		a.reportExpired(&report, run, users)
+	}
+
+	sources := make(map[*models.Track]downloader.DownloadPreview, len(previews))
+	for _, preview := range previews {
+		sources[preview.Track] = preview
+	}
+
+	for _, playlist := range playlists {
+		fmt.Fprintf(&report, "\nPlaylist %s (%d tracks)\n", playlistLabel(playlist), len(playlist.Tracks))
+		for _, track := range playlist.Tracks {
+			preview, missing := sources[track]
+			switch {
+			case !missing:
+				fmt.Fprintf(&report, "  %-12s %s - %s\n", "[present]", track.Artist, track.Title)
+			case preview.Downloader != "":
+				fmt.Fprintf(&report, "  %-12s %s - %s (%s)\n", "["+preview.Downloader+"]", track.Artist, track.Title, preview.Source)
+			default:
+				fmt.Fprintf(&report, "  %-12s %s - %s: %s\n", "[not found]", track.Artist, track.Title, strings.Join(preview.Errors, "; "))
+			}
+		}
+	}
+
+	var found int
+	for _, preview := range previews {
+		if preview.Downloader != "" {
+			found++
+		}
+	}
+	fmt.Fprintf(&report, "\n%d tracks present, %d would be downloaded, %d not found\n",
+		len(tracks)-len(previews), found, len(previews)-found)
+
+	fmt.Print(report.String())
+	return nil
+}
+
+func playlistLabel(playlist *models.Playlist) string {
+	if playlist.User != "" {
+		return playlist.Name + " of " + playlist.User
+	}
+	return playlist.Name
+}
@@ -0,0 +1,321 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+
+	"explo/src/client"
+	"explo/src/config"
+	"explo/src/discovery"
+	"explo/src/downloader"
+	"explo/src/models"
+	"explo/src/store"
+)
+
+type user struct { // connections and playlists of a user in EXPLO_USERS, or of the only user
+	cfg       *config.Config
+	clients   []*client.Client
+	playlists []*models.Playlist
+}
+
+func (a *App) explore(ctx context.Context, run *store.Run) error { // Discover, download and create playlists, recording the outcome of each stage
+	cfg, state := a.cfg, a.State
+	users, err := a.connectUsers()
+	if err != nil {
+		return err
+	}
+	downloader := downloader.NewDownloader(&cfg.DownloadCfg, a.httpClient)
+
+	var playlists []*models.Playlist
+	var errs []error
+	for _, user := range users {
+		discovered, err := a.discover(user)
+		if err != nil {
+			if user.cfg.User != "" {
+				log.Printf("[%s] discovery failed: %s", user.cfg.User, err.Error())
+			}
+			errs = append(errs, err)
+			continue
+		}
+		for _, playlist := range discovered {
+			playlist.Name = cfg.GetPlaylistName(playlist.Name, playlist.Period)
+			playlist.User = user.cfg.User
+		}
+		user.playlists = discovered
+		playlists = append(playlists, discovered...)
+	}
+	if len(errs) == len(users) {
+		return errors.Join(errs...)
+	}
+	discovery.ShareTracks(playlists) // a track recommended to several users is downloaded once
+	record(state.RecordDiscovery(run, playlists))
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	systems := systemClients(users)
+	if cfg.DryRun {
+		return a.dryRun(ctx, run, users, systems, downloader)
+	}
+
+	if !cfg.Persist {
+		liked, err := likedFiles(users) // read before playlists are deleted, so engagement in them counts
+		for _, user := range users {
+			for _, client := range user.clients {
+				for _, playlist := range user.playlists {
+					client.SetPlaylist(playlist.Name)
+					if err := client.DeletePlaylist(); err != nil {
+						log.Println(err)
+					}
+				}
+			}
+		}
+		if err != nil {
+			log.Printf("%s, downloads are not deleted", err.Error())
+		} else {
+			downloader.DeleteSongs(liked)
+		}
+	}
+
+	discovered := uniqueTracks(playlists)
+	checkTracks(systems, discovered) // Check if tracks exist on any system before downloading
+	record(state.RecordTracks(run, discovered))
+
+	tracks := slices.Clone(discovered)
+	downloader.StartDownload(ctx, &tracks)
+	record(state.RecordTracks(run, discovered))
+	if cfg.ServerCfg.Review && cfg.ServerCfg.Address != "" { // review happens in the dashboard
+		if tracks, err = a.reviewTracks(ctx, run, playlists, discovered, tracks, downloader); err != nil {
+			return err
+		}
+	}
+	if len(tracks) == 0 {
+		return fmt.Errorf("couldn't download any tracks")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	errs = nil
+	for _, system := range systems { // the library is scanned once per system, then each user gets their playlists
+		copies, err := refreshLibrary(ctx, system, tracks)
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			log.Printf("[%s] %s", system.System, err.Error())
+			errs = append(errs, fmt.Errorf("%s: %w", system.System, err))
+			continue
+		}
+		for _, user := range users {
+			for _, c := range user.clients {
+				if c.System == system.System {
+					a.createPlaylists(run, c, user, tracks, copies)
+				}
+			}
+		}
+	}
+	record(state.RecordTracks(run, tracks))
+	if len(errs) == len(systems) { // the run failed if no system got its playlists
+		return errors.Join(errs...)
+	}
+
+	if cfg.Persist && cfg.Retention() > 0 {
+		if err := a.expire(run, users); err != nil {
+			log.Printf("failed to apply retention: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+func (a *App) discover(user *user) ([]*models.Playlist, error) { // library discovery uses the first system's listening history
+	discoverer, err := discovery.NewDiscoverer(user.cfg.DiscoveryCfg, a.httpClient, user.clients[0])
+	if err != nil {
+		return nil, err
+	}
+	return discoverer.Discover()
+}
+
+func (a *App) connectUsers() ([]*user, error) { // connect every user to their systems, users that can't connect to any are skipped
+	configs, err := a.cfg.ForUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	var users []*user
+	var errs []error
+	for _, cfg := range configs {
+		clients, err := a.connect(cfg)
+		if err != nil {
+			if cfg.User != "" {
+				log.Printf("[%s] skipping user: %s", cfg.User, err.Error())
+				err = fmt.Errorf("%s: %w", cfg.User, err)
+			}
+			errs = append(errs, err)
+			continue
+		}
+		users = append(users, &user{cfg: cfg, clients: clients})
+	}
+	if len(users) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	return users, nil
+}
+
+func (a *App) connect(cfg *config.Config) ([]*client.Client, error) { // connect to every system in EXPLO_SYSTEM, systems that fail are skipped
+	var clients []*client.Client
+	var errs []error
+	for _, name := range cfg.SystemNames() {
+		systemCfg, err := cfg.ForSystem(name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		c, err := client.NewClient(systemCfg, a.httpClient)
+		if err != nil {
+			log.Printf("[%s] skipping system: %s", name, err.Error())
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		clients = append(clients, c)
+	}
+	if len(clients) == 0 {
+		return nil, errors.Join(append(errs, errors.New("no music system available"))...)
+	}
+	return clients, nil
+}
+
+func refreshLibrary(ctx context.Context, c *client.Client, tracks []*models.Track) (map[*models.Track]*models.Track, error) { // scan the system's library, returns the system's copy of each track
+	found := systemTracks(tracks)
+	if err := c.RefreshLibrary(ctx, found); err != nil {
+		return nil, err
+	}
+	copies := make(map[*models.Track]*models.Track, len(tracks))
+	for i, track := range tracks {
+		copies[track] = found[i]
+		if found[i].Present && !track.Present { // present in any system
+			track.Present, track.LibraryID = true, found[i].LibraryID
+		}
+	}
+	return copies, ctx.Err()
+}
+
+func (a *App) createPlaylists(run *store.Run, c *client.Client, user *user, tracks []*models.Track, copies map[*models.Track]*models.Track) { // create the user's playlists with the tracks the system found
+	owner := ""
+	if user.cfg.User != "" {
+		owner = " for " + user.cfg.User
+	}
+
+	var created int
+	for _, playlist := range user.playlists {
+		var playlistTracks []*models.Track
+		for _, track := range keepTracks(playlist.Tracks, tracks) {
+			if found := copies[track]; found != nil && found.Present { // kept tracks may only be in another system
+				playlistTracks = append(playlistTracks, found)
+			}
+		}
+		if len(playlistTracks) == 0 {
+			log.Printf("[%s] no tracks available for %s%s, skipping playlist", c.System, playlist.Name, owner)
+			continue
+		}
+
+		c.SetPlaylist(playlist.Name)
+		if err := c.CreatePlaylist(playlistTracks, playlist.Description); err != nil {
+			log.Println(err)
+		} else {
+			log.Printf("[%s] %s playlist created successfully%s", c.System, playlist.Name, owner)
+			record(a.State.RecordPlaylist(run, c.System, playlist))
+			created++
+		}
+	}
+	log.Printf("[%s] created %d of %d playlists%s", c.System, created, len(user.playlists), owner)
+}
+
+func likedFiles(users []*user) ([]string, error) { // downloads any user liked in any system
+	var liked []string
+	for _, user := range users {
+		for _, c := range user.clients {
+			files, err := c.LikedFiles()
+			if err != nil {
+				return nil, err
+			}
+			liked = append(liked, files...)
+		}
+	}
+	slices.Sort(liked)
+	return slices.Compact(liked), nil
+}
+
+func systemClients(users []*user) []*client.Client { // the first connection to each system, used for library lookups shared by all users
+	var clients []*client.Client
+	seen := make(map[string]bool)
+	for _, user := range users {
+		for _, c := range user.clients {
+			if !seen[c.System] {
+				seen[c.System] = true
+				clients = append(clients, c)
+			}
+		}
+	}
+	return clients
+}
+
+func checkTracks(clients []*client.Client, tracks []*models.Track) { // a track is present if any system has it
+	for _, c := range clients {
+		found := systemTracks(tracks)
+		c.CheckTracks(found)
+		for i, track := range tracks {
+			if found[i].Present && !track.Present {
+				track.Present, track.LibraryID = true, found[i].LibraryID
+			}
+		}
+	}
+}
+
+func systemTracks(tracks []*models.Track) []*models.Track { // copies of tracks, so each system sets its own library IDs
+	copies := make([]*models.Track, len(tracks))
+	for i, track := range tracks {
+		found := *track
+		found.Present, found.LibraryID = false, ""
+		copies[i] = &found
+	}
+	return copies
+}
+
+func record(err error) { // failing to save history shouldn't stop the run
+	if err != nil {
+		log.Printf("warning: %s", err.Error())
+	}
+}
+
+func uniqueTracks(playlists []*models.Playlist) []*models.Track { // Collect tracks of all playlists, tracks shared between playlists are added once
+	seen := make(map[*models.Track]bool)
+	var tracks []*models.Track
+	for _, playlist := range playlists {
+		for _, track := range playlist.Tracks {
+			if !seen[track] {
+				seen[track] = true
+				tracks = append(tracks, track)
+			}
+		}
+	}
+	return tracks
+}
+
+func keepTracks(tracks, available []*models.Track) []*models.Track { // Only keep tracks that were downloaded or found in the system
+	keep := make(map[*models.Track]bool, len(available))
+	for _, track := range available {
+		keep[track] = true
+	}
+
+	var kept []*models.Track
+	for _, track := range tracks {
+		if keep[track] {
+			kept = append(kept, track)
+		}
+	}
+	return kept
+}
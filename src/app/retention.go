@@ -0,0 +1,158 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"explo/src/client"
+	"explo/src/store"
+)
+
+// expiry lists the runs the retention policy cleans up, and what newer runs still use
+type expiry struct {
+	runs      []store.Run
+	playlists map[string]bool // user and name of playlists in newer runs
+	tracks    map[string]bool // keys and paths of tracks in newer runs
+}
+
+func (a *App) findExpired(current *store.Run) (*expiry, error) { // runs older than RETENTION_WEEKS or RETENTION_DAYS that weren't cleaned up yet
+	runs, err := a.State.Runs(0)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-a.cfg.Retention())
+	e := &expiry{playlists: make(map[string]bool), tracks: make(map[string]bool)}
+	for _, run := range runs {
+		if run.DryRun || run.Expired {
+			continue
+		}
+		if run.ID != current.ID && run.Started.Before(cutoff) {
+			e.runs = append(e.runs, run)
+			continue
+		}
+		for _, playlist := range run.Playlists {
+			e.playlists[playlist.User+"/"+playlist.Name] = true
+			for _, key := range playlist.Tracks {
+				e.tracks[key] = true
+			}
+		}
+		for _, track := range run.Tracks {
+			if track.Path != "" {
+				e.tracks[track.Path] = true
+			}
+		}
+	}
+	return e, nil
+}
+
+func (e *expiry) files(run store.Run, liked []string, downloadDir string) []string { // downloads of the run that no newer run uses and nobody liked
+	var files []string
+	for _, track := range run.Tracks {
+		if track.Status != store.StatusDownloaded || track.Path == "" || !strings.HasPrefix(track.Path, downloadDir) { // only files Explo downloaded
+			continue
+		}
+		if e.tracks[track.Key] || e.tracks[track.Path] || slices.Contains(liked, filepath.Clean(track.Path)) {
+			continue
+		}
+		files = append(files, track.Path)
+	}
+	return files
+}
+
+func (a *App) expire(current *store.Run, users []*user) error { // delete playlists and downloads of expired runs
+	e, err := a.findExpired(current)
+	if err != nil || len(e.runs) == 0 {
+		return err
+	}
+	liked, err := likedFiles(users)
+	if err != nil {
+		return err
+	}
+
+	for i := range e.runs {
+		run := &e.runs[i]
+		for _, playlist := range run.Playlists {
+			if e.playlists[playlist.User+"/"+playlist.Name] { // created again by a newer run in the same week
+				continue
+			}
+			for _, system := range playlistSystems(run, playlist) {
+				c := userClient(users, playlist.User, system)
+				if c == nil {
+					log.Printf("[%s] not connected, can't delete expired playlist %s", system, playlist.Name)
+					continue
+				}
+				c.SetPlaylist(playlist.Name)
+				if err := c.DeletePlaylist(); err != nil {
+					log.Println(err)
+				} else {
+					log.Printf("[%s] deleted expired playlist %s", system, playlist.Name)
+				}
+			}
+		}
+
+		var removed int
+		for _, file := range e.files(*run, liked, a.cfg.DownloadCfg.DownloadDir) {
+			if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("failed to remove file: %s", err.Error())
+				continue
+			}
+			removed++
+		}
+		log.Printf("run %d expired, removed %d downloads", run.ID, removed)
+		record(a.State.ExpireRun(run))
+	}
+	return nil
+}
+
+func (a *App) reportExpired(report *strings.Builder, current *store.Run, users []*user) { // dry run part of expire
+	e, err := a.findExpired(current)
+	if err != nil {
+		fmt.Fprintf(report, "\nRetention can't be applied: %s\n", err.Error())
+		return
+	}
+	liked, err := likedFiles(users)
+	if err != nil {
+		fmt.Fprintf(report, "\nRetention can't be applied: %s\n", err.Error())
+		return
+	}
+
+	for _, run := range e.runs {
+		fmt.Fprintf(report, "\nRun %d (%s) has expired\n", run.ID, run.Started.Format(time.DateOnly))
+		for _, playlist := range run.Playlists {
+			if systems := playlistSystems(&run, playlist); len(systems) > 0 && !e.playlists[playlist.User+"/"+playlist.Name] {
+				fmt.Fprintf(report, "  Playlist %s would be deleted from %s\n", playlist.Name, strings.Join(systems, ", "))
+			}
+		}
+		for _, file := range e.files(run, liked, a.cfg.DownloadCfg.DownloadDir) {
+			fmt.Fprintf(report, "  %s would be deleted\n", file)
+		}
+	}
+}
+
+func playlistSystems(run *store.Run, playlist store.Playlist) []string { // systems the playlist was created in
+	if len(playlist.Systems) > 0 || !playlist.Created {
+		return playlist.Systems
+	}
+	return strings.Split(run.System, ",") // recorded before playlists kept their systems
+}
+
+func userClient(users []*user, name, system string) *client.Client {
+	for _, user := range users {
+		if user.cfg.User != name {
+			continue
+		}
+		for _, c := range user.clients {
+			if c.System == strings.TrimSpace(system) {
+				return c
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"explo/src/downloader"
+	"explo/src/models"
+	"explo/src/store"
+)
+
+// Track states shown in the review
+const (
+	InLibrary  = "in library"
+	Downloaded = "downloaded"
+	Failed     = "failed"
+	Retrying   = "retrying"
+	Rejected   = "rejected"
+)
+
+var ErrNoReview = errors.New("no review in progress")
+
+// Review holds the tracks of a run until they're published
+type Review struct {
+	mu         sync.Mutex
+	runID      uint64
+	deadline   time.Time
+	tracks     []*models.Track
+	available  map[*models.Track]bool // tracks that will be added to playlists
+	retrying   map[*models.Track]bool
+	playlists  map[*models.Track][]string
+	download   func(*models.Track) error
+	record     func(*models.Track)
+	published  chan struct{}
+	publishOne sync.Once
+	closed     bool // set once the pipeline continued, late retries are ignored
+}
+
+type ReviewTrack struct {
+	Index      int
+	Artist     string
+	Title      string
+	Album      string
+	Playlists  []string
+	State      string
+	Downloader string `json:",omitempty"`
+	Source     string `json:",omitempty"` // link to the YouTube video or slskd user and file
+	FailReason string `json:",omitempty"`
+	Review     string `json:",omitempty"`
+}
+
+type ReviewView struct {
+	RunID    uint64
+	Deadline time.Time `json:",omitempty"` // tracks are published automatically after this
+	Tracks   []ReviewTrack
+}
+
+func (a *App) Review() (*Review, error) { // review waiting for decisions
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.review == nil {
+		return nil, ErrNoReview
+	}
+	return a.review, nil
+}
+
+func (a *App) reviewTracks(ctx context.Context, run *store.Run, playlists []*models.Playlist, tracks, available []*models.Track, dl *downloader.DownloadClient) ([]*models.Track, error) { // wait until tracks are published from the dashboard
+	retryCtx, cancelRetries := context.WithCancel(ctx) // retries still running when the review closes are cancelled
+	defer cancelRetries()
+
+	r := &Review{
+		runID:     run.ID,
+		tracks:    tracks,
+		available: make(map[*models.Track]bool, len(available)),
+		retrying:  make(map[*models.Track]bool),
+		playlists: make(map[*models.Track][]string),
+		download: func(track *models.Track) error {
+			return dl.DownloadTrack(retryCtx, track)
+		},
+		record: func(track *models.Track) {
+			record(a.State.RecordTracks(run, []*models.Track{track}))
+		},
+		published: make(chan struct{}),
+	}
+	for _, track := range available {
+		r.available[track] = true
+	}
+	for _, playlist := range playlists {
+		for _, track := range playlist.Tracks {
+			r.playlists[track] = append(r.playlists[track], playlist.Name)
+		}
+	}
+
+	var timeout <-chan time.Time
+	if hours := a.cfg.ServerCfg.ReviewTimeout; hours > 0 {
+		r.deadline = time.Now().Add(time.Duration(hours) * time.Hour)
+		timeout = time.After(time.Until(r.deadline))
+	}
+
+	a.mu.Lock()
+	a.review = r
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		a.review = nil
+		a.mu.Unlock()
+	}()
+
+	log.Printf("waiting for %d tracks to be reviewed in the dashboard", len(tracks))
+	select {
+	case <-r.published:
+	case <-timeout:
+		log.Printf("review wasn't published in %d hours, publishing tracks as they are", a.cfg.ServerCfg.ReviewTimeout)
+		r.Publish()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	cancelRetries()
+	var approved []*models.Track
+	for _, track := range tracks {
+		if r.available[track] && !r.retrying[track] {
+			approved = append(approved, track)
+		}
+	}
+	return approved, nil
+}
+
+func (r *Review) View() ReviewView {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	view := ReviewView{RunID: r.runID, Deadline: r.deadline}
+	for i, track := range r.tracks {
+		view.Tracks = append(view.Tracks, ReviewTrack{
+			Index:      i,
+			Artist:     track.Artist,
+			Title:      track.Title,
+			Album:      track.Album,
+			Playlists:  r.playlists[track],
+			State:      r.state(track),
+			Downloader: track.Downloader,
+			Source:     source(*track),
+			FailReason: track.FailReason,
+			Review:     track.Review,
+		})
+	}
+	return view
+}
+
+func (r *Review) Approve(index int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	track, err := r.track(index)
+	if err != nil {
+		return err
+	}
+	if !r.available[track] {
+		return fmt.Errorf("%s - %s isn't available, retry it first", track.Artist, track.Title)
+	}
+	track.Review = models.ReviewApproved
+	r.record(track)
+	return nil
+}
+
+func (r *Review) Reject(index int) error { // remove track from playlists, downloaded files are deleted
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	track, err := r.track(index)
+	if err != nil {
+		return err
+	}
+	r.reject(track)
+	r.record(track)
+	return nil
+}
+
+func (r *Review) Retry(index int) error { // reject the current download and download the track again from another source
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	track, err := r.track(index)
+	if err != nil {
+		return err
+	}
+	if track.Downloader == "" && r.available[track] {
+		return fmt.Errorf("%s - %s is already in the library", track.Artist, track.Title)
+	}
+	r.reject(track)
+
+	retry := *track
+	retry.Present, retry.Downloader, retry.DownloadID, retry.DownloadUser = false, "", "", ""
+	retry.File, retry.Path, retry.FailReason, retry.Review = "", "", "", ""
+	retry.Rejected = slices.Clone(track.Rejected)
+	r.retrying[track] = true
+
+	go func() { // downloads can take minutes, the track is updated once it's done
+		err := r.download(&retry)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.closed { // the file wouldn't be in any playlist or run record, so retention couldn't remove it
+			if retry.Path != "" {
+				if err := os.Remove(retry.Path); err != nil && !os.IsNotExist(err) {
+					log.Printf("failed to remove %s: %s", retry.Path, err.Error())
+				}
+			}
+			log.Printf("%s - %s was published before its retry finished, it won't be added to playlists", track.Artist, track.Title)
+			return
+		}
+		*track = retry
+		delete(r.retrying, track)
+		if err != nil {
+			log.Printf("retry failed: %s", err.Error())
+		} else {
+			r.available[track] = true
+		}
+		r.record(track)
+	}()
+	return nil
+}
+
+func (r *Review) Publish() {
+	r.publishOne.Do(func() { close(r.published) })
+}
+
+func (r *Review) reject(track *models.Track) {
+	if track.Review == models.ReviewRejected {
+		return
+	}
+	if track.Downloader != "" && track.Path != "" { // only remove files Explo downloaded
+		if err := os.Remove(track.Path); err != nil && !os.IsNotExist(err) {
+			log.Printf("failed to remove %s: %s", track.Path, err.Error())
+		}
+	}
+	if source := downloader.Source(*track); source != "" {
+		track.Rejected = append(track.Rejected, source)
+	}
+	track.Review = models.ReviewRejected
+	delete(r.available, track)
+}
+
+func (r *Review) track(index int) (*models.Track, error) {
+	if index < 0 || index >= len(r.tracks) {
+		return nil, fmt.Errorf("track %d not found", index)
+	}
+	track := r.tracks[index]
+	if r.retrying[track] {
+		return nil, fmt.Errorf("%s - %s is being downloaded again", track.Artist, track.Title)
+	}
+	return track, nil
+}
+
+func (r *Review) state(track *models.Track) string {
+	switch {
+	case r.retrying[track]:
+		return Retrying
+	case track.Review == models.ReviewRejected:
+		return Rejected
+	case r.available[track] && track.Downloader != "":
+		return Downloaded
+	case r.available[track]:
+		return InLibrary
+	}
+	return Failed
+}
+
+func source(track models.Track) string {
+	switch track.Downloader {
+	case "youtube":
+		return "https://www.youtube.com/watch?v=" + track.DownloadID
+	case "slskd":
+		return track.DownloadUser + ": " + track.File
+	}
+	return ""
+}
@@ -0,0 +1,225 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"explo/src/config"
+	"explo/src/debug"
+	"explo/src/models"
+	"explo/src/util"
+)
+
+type AmpacheError struct {
+	Error *struct {
+		Code    string `json:"errorCode"`
+		Message string `json:"errorMessage"`
+	} `json:"error"`
+}
+
+type AmpacheSongs struct {
+	Song []struct {
+		ID     string `json:"id"`
+		Title  string `json:"title"`
+		Time   int    `json:"time"`
+		MBID   string `json:"mbid"`
+		Artist struct {
+			Name string `json:"name"`
+		} `json:"artist"`
+	} `json:"song"`
+}
+
+type AmpacheArtists struct {
+	Artist []struct {
+		Name string `json:"name"`
+	} `json:"artist"`
+}
+
+type AmpacheCatalogs struct {
+	Catalog []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"catalog"`
+}
+
+type AmpachePlaylists struct {
+	Playlist []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"playlist"`
+}
+
+// Ampache uses the JSON API, authenticated with a session from the handshake
+type Ampache struct {
+	LibraryID  string // catalog named LIBRARY_NAME
+	Session    string
+	HttpClient *util.HttpClient
+	Cfg        *config.ClientConfig
+}
+
+func NewAmpache(cfg *config.ClientConfig, httpClient *util.HttpClient) *Ampache {
+	return &Ampache{Cfg: cfg,
+		HttpClient: httpClient}
+}
+
+func (c *Ampache) AddHeader() error {
+	return nil
+}
+
+func (c *Ampache) GetAuth() error { // handshake with API_KEY, or SYSTEM_USERNAME and SYSTEM_PASSWORD
+	params := url.Values{"version": {"6.0.0"}}
+	if c.Cfg.Creds.APIKey != "" {
+		params.Set("auth", c.Cfg.Creds.APIKey)
+	} else {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		key := fmt.Sprintf("%x", sha256.Sum256([]byte(c.Cfg.Creds.Password)))
+		params.Set("auth", fmt.Sprintf("%x", sha256.Sum256([]byte(timestamp+key))))
+		params.Set("timestamp", timestamp)
+		params.Set("user", c.Cfg.Creds.User)
+	}
+
+	var handshake struct {
+		Auth string `json:"auth"`
+	}
+	if err := c.ampacheRequest("handshake", params, &handshake); err != nil {
+		return fmt.Errorf("handshake failed: %s", err.Error())
+	}
+	c.Session = handshake.Auth
+	return nil
+}
+
+func (c *Ampache) GetLibrary() error {
+	var catalogs AmpacheCatalogs
+	if err := c.ampacheRequest("catalogs", url.Values{"filter": {"music"}}, &catalogs); err != nil {
+		return err
+	}
+
+	for _, catalog := range catalogs.Catalog {
+		if catalog.Name == c.Cfg.LibraryName {
+			c.LibraryID = catalog.ID
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to find catalog named %s", c.Cfg.LibraryName)
+}
+
+func (c *Ampache) AddLibrary() error {
+	return nil
+}
+
+func (c *Ampache) SearchSongs(tracks []*models.Track) error {
+	for _, track := range tracks {
+		var songs AmpacheSongs
+		if err := c.ampacheRequest("songs", url.Values{"filter": {track.CleanTitle}, "limit": {"50"}}, &songs); err != nil {
+			debug.Debug(fmt.Sprintf("failed to search for '%s': %s", track.Title, err.Error()))
+			continue
+		}
+
+		for _, song := range songs.Song {
+			mbidMatch := track.RecordingMBID != "" && strings.EqualFold(song.MBID, track.RecordingMBID)
+			if mbidMatch || (strings.EqualFold(song.Title, track.CleanTitle) && strings.Contains(strings.ToLower(song.Artist.Name), strings.ToLower(track.MainArtist))) {
+				track.LibraryID = song.ID
+				track.Present = true
+				if track.Duration == 0 {
+					track.Duration = song.Time * 1000
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Ampache) GetTopArtists(limit int) ([]string, error) {
+	var artists AmpacheArtists
+	params := url.Values{"type": {"artist"}, "filter": {"frequent"}, "limit": {strconv.Itoa(limit)}}
+	if err := c.ampacheRequest("stats", params, &artists); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, artist := range artists.Artist {
+		names = append(names, artist.Name)
+	}
+	return rankArtists(names, limit), nil
+}
+
+func (c *Ampache) RefreshLibrary() error { // look for new files in the catalog
+	var result map[string]any
+	return c.ampacheRequest("catalog_action", url.Values{"task": {"add_to_catalog"}, "catalog": {c.LibraryID}}, &result)
+}
+
+func (c *Ampache) ScanStatus() (bool, error) { // catalog_action only responds once the catalog is updated, there's no scan to wait for
+	return false, nil
+}
+
+func (c *Ampache) CreatePlaylist(tracks []*models.Track) error {
+	var playlist struct {
+		ID string `json:"id"`
+	}
+	if err := c.ampacheRequest("playlist_create", url.Values{"name": {c.Cfg.PlaylistName}, "type": {"private"}}, &playlist); err != nil {
+		return err
+	}
+	c.Cfg.PlaylistID = playlist.ID
+
+	for _, track := range tracks {
+		if !track.Present {
+			continue
+		}
+		var result map[string]any
+		if err := c.ampacheRequest("playlist_add_song", url.Values{"filter": {c.Cfg.PlaylistID}, "song": {track.LibraryID}}, &result); err != nil {
+			return fmt.Errorf("failed to add %s - %s: %s", track.Artist, track.Title, err.Error())
+		}
+	}
+	return nil
+}
+
+func (c *Ampache) SearchPlaylist() error {
+	var playlists AmpachePlaylists
+	if err := c.ampacheRequest("playlists", url.Values{"filter": {c.Cfg.PlaylistName}, "exact": {"1"}}, &playlists); err != nil {
+		return err
+	}
+
+	for _, playlist := range playlists.Playlist {
+		if playlist.Name == c.Cfg.PlaylistName {
+			c.Cfg.PlaylistID = playlist.ID
+			return nil
+		}
+	}
+	return nil
+}
+
+func (c *Ampache) UpdatePlaylist(description string) error { // Ampache playlists have no description
+	return nil
+}
+
+func (c *Ampache) DeletePlaylist() error {
+	var result map[string]any
+	return c.ampacheRequest("playlist_delete", url.Values{"filter": {c.Cfg.PlaylistID}}, &result)
+}
+
+func (c *Ampache) ampacheRequest(action string, params url.Values, target any) error {
+	params.Set("action", action)
+	if action != "handshake" {
+		params.Set("auth", c.Session)
+	}
+
+	body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+"/server/json.server.php?"+params.Encode(), nil, nil)
+	if err != nil {
+		return err
+	}
+
+	var checkResp AmpacheError
+	if err = util.ParseResp(body, &checkResp); err == nil && checkResp.Error != nil {
+		return fmt.Errorf("%s failed: %s", action, checkResp.Error.Message)
+	}
+	if err = json.Unmarshal(body, target); err != nil {
+		return fmt.Errorf("failed to parse %s response: %s", action, err.Error())
+	}
+	return nil
+}
@@ -1,11 +1,16 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"explo/src/config"
+	"explo/src/debug"
 	"explo/src/models"
 	"explo/src/util"
 )
@@ -23,13 +28,38 @@ type APIClient interface {
 	AddHeader() error
 	AddLibrary() error
 	SearchSongs([]*models.Track) error
+	GetTopArtists(int) ([]string, error)
 	RefreshLibrary() error
+	ScanStatus() (bool, error)
 	CreatePlaylist([]*models.Track) error
 	SearchPlaylist() error
 	UpdatePlaylist(string) error
 	DeletePlaylist() error
 }
 
+// PathRefresher is implemented by systems that can scan single files or folders instead of the whole library
+type PathRefresher interface {
+	RefreshPaths([]string) error
+}
+
+// DelayedRefresher is implemented by path refreshers that only queue the files, the system imports them after a delay
+type DelayedRefresher interface {
+	PathRefresher
+	RefreshDelay() time.Duration // how long the system waits before importing reported files by default
+}
+
+// LikeReader is implemented by systems that keep favourites, ratings or play counts of tracks
+type LikeReader interface {
+	LikedTracks() ([]LikedTrack, error)
+}
+
+type LikedTrack struct {
+	Path     string // as the music system sees it, relative to the library folder's root for subsonic and navidrome
+	Favorite bool
+	Rating   int // stars out of 5, 0 if not rated
+	Plays    int
+}
+
 // NewClient initializes a client and sets up authentication
 func NewClient(cfg *config.Config, httpClient *util.HttpClient) (*Client, error) {
 	c := &Client{
@@ -38,23 +68,44 @@ func NewClient(cfg *config.Config, httpClient *util.HttpClient) (*Client, error)
 	}
 	switch c.System {
 
+	case "ampache":
+		c.API = NewAmpache(&cfg.ClientCfg, httpClient)
+
 	case "emby":
-		c.API = NewEmby(cfg.ClientCfg, httpClient)
+		c.API = NewEmby(&cfg.ClientCfg, httpClient)
+
+	case "funkwhale":
+		c.API = NewFunkwhale(&cfg.ClientCfg, httpClient)
 
 	case "jellyfin":
-		c.API = NewJellyfin(cfg.ClientCfg, httpClient)
+		c.API = NewJellyfin(&cfg.ClientCfg, httpClient)
+
+	case "kodi":
+		c.API = NewKodi(&cfg.ClientCfg, httpClient)
+
+	case "lms":
+		c.API = NewLMS(&cfg.ClientCfg, httpClient)
 
 	case "mpd":
-		c.API = NewMPD(cfg.ClientCfg)
+		if cfg.ClientCfg.MPD.Address != "" {
+			c.API = NewMPDServer(&cfg.ClientCfg)
+		} else {
+			c.API = NewMPD(&cfg.ClientCfg)
+		}
+
+	case "navidrome":
+		c.API = NewNavidrome(&cfg.ClientCfg, httpClient)
 
 	case "plex":
-		c.API = NewPlex(cfg.ClientCfg, httpClient)
+		plex := NewPlex(&cfg.ClientCfg, httpClient)
+		plex.DryRun = cfg.DryRun
+		c.API = plex
 
 	case "subsonic":
-		c.API = NewSubsonic(cfg.ClientCfg, httpClient)
+		c.API = NewSubsonic(&cfg.ClientCfg, httpClient)
 
 	default:
-		log.Fatalf("unknown system: %s. Use a supported system (emby, jellyfin, mpd, plex, or subsonic).", c.System)
+		log.Fatalf("unknown system: %s. Use a supported system (ampache, emby, funkwhale, jellyfin, kodi, lms, mpd, navidrome, plex, or subsonic).", c.System)
 	}
 
 	if err := c.systemSetup(); err != nil { // Run setup automatically
@@ -73,6 +124,12 @@ func (c *Client) systemSetup() error {
 		}
 		return c.API.GetAuth()
 
+	case "navidrome":
+		if c.Cfg.Creds.User == "" || c.Cfg.Creds.Password == "" {
+			return fmt.Errorf("Navidrome USER and PASSWORD are required")
+		}
+		return c.API.GetAuth()
+
 	case "jellyfin":
 		if c.Cfg.Creds.APIKey == "" {
 			return fmt.Errorf("Jellyfin API_KEY is required")
@@ -83,11 +140,29 @@ func (c *Client) systemSetup() error {
 		return c.API.GetLibrary()
 
 	case "mpd":
+		if c.Cfg.MPD.Address != "" {
+			return c.API.GetLibrary()
+		}
 		if c.Cfg.PlaylistDir == "" {
-			return fmt.Errorf("MPD PLAYLIST_DIR is required")
+			return fmt.Errorf("MPD PLAYLIST_DIR or MPD_ADDRESS is required")
 		}
 		return nil
 
+	case "lms":
+		if err := c.API.AddHeader(); err != nil {
+			return err
+		}
+		return c.API.GetLibrary()
+
+	case "kodi":
+		if c.Cfg.PlaylistDir == "" {
+			return fmt.Errorf("Kodi PLAYLIST_DIR is required")
+		}
+		if err := c.API.AddHeader(); err != nil {
+			return err
+		}
+		return c.API.GetLibrary()
+
 	case "plex":
 		if (c.Cfg.Creds.User == "" || c.Cfg.Creds.Password == "") && c.Cfg.Creds.APIKey == "" {
 			return fmt.Errorf("Plex USER/PASSWORD or API_KEY is required")
@@ -106,6 +181,24 @@ func (c *Client) systemSetup() error {
 		}
 		return c.API.GetLibrary()
 
+	case "ampache":
+		if (c.Cfg.Creds.User == "" || c.Cfg.Creds.Password == "") && c.Cfg.Creds.APIKey == "" {
+			return fmt.Errorf("Ampache USER/PASSWORD or API_KEY is required")
+		}
+		if err := c.API.GetAuth(); err != nil {
+			return err
+		}
+		return c.API.GetLibrary()
+
+	case "funkwhale":
+		if c.Cfg.Creds.APIKey == "" {
+			return fmt.Errorf("Funkwhale API_KEY is required")
+		}
+		if err := c.API.AddHeader(); err != nil {
+			return err
+		}
+		return c.API.GetLibrary()
+
 	case "emby":
 		if c.Cfg.Creds.APIKey == "" {
 			return fmt.Errorf("Emby API_KEY is required")
@@ -116,7 +209,7 @@ func (c *Client) systemSetup() error {
 		return c.API.GetLibrary()
 
 	default:
-		return fmt.Errorf("unknown system: %s. Use a supported system (emby, jellyfin, mpd, plex, or subsonic)", c.System)
+		return fmt.Errorf("unknown system: %s. Use a supported system (ampache, emby, funkwhale, jellyfin, kodi, lms, mpd, navidrome, plex, or subsonic)", c.System)
 	}
 }
 
@@ -126,25 +219,214 @@ func (c *Client) CheckTracks(tracks []*models.Track) {
 	}
 }
 
-func (c *Client) CreatePlaylist(tracks []*models.Track) error {
+// TopArtists returns the most played artists in the music system
+func (c *Client) TopArtists(limit int) ([]string, error) {
+	artists, err := c.API.GetTopArtists(limit)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] failed to get top artists: %s", c.System, err.Error())
+	}
+	return artists, nil
+}
+
+// LikedFiles returns the paths under DOWNLOAD_DIR of downloads liked according to KEEP_TRACKS, nil if the system doesn't keep track of likes
+func (c *Client) LikedFiles() ([]string, error) {
+	reader, ok := c.API.(LikeReader)
+	if !ok || len(c.Cfg.Keep) == 0 {
+		return nil, nil
+	}
+	tracks, err := reader.LikedTracks()
+	if err != nil {
+		return nil, fmt.Errorf("[%s] failed to get liked tracks: %s", c.System, err.Error())
+	}
+
+	var files []string
+	for _, track := range tracks {
+		if (track.Favorite && slices.Contains(c.Cfg.Keep, "favorite")) ||
+			(track.Rating > 0 && track.Rating >= c.Cfg.KeepRating && slices.Contains(c.Cfg.Keep, "rating")) ||
+			(track.Plays > 0 && slices.Contains(c.Cfg.Keep, "played")) {
+			file, ok, err := c.downloadPath(track.Path)
+			if err != nil { // a liked download could be deleted otherwise
+				return nil, fmt.Errorf("[%s] %s", c.System, err.Error())
+			}
+			if ok {
+				files = append(files, file)
+			}
+		}
+	}
+	return files, nil
+}
+
+// SetPlaylist selects the playlist the following calls operate on
+func (c *Client) SetPlaylist(name string) {
+	c.Cfg.PlaylistName = name
+	c.Cfg.PlaylistID = ""
+}
+
+// PlaylistExists checks if a playlist with the given name is in the system, the selected playlist is kept
+func (c *Client) PlaylistExists(name string) bool {
+	previousName, previousID := c.Cfg.PlaylistName, c.Cfg.PlaylistID
+	defer func() { c.Cfg.PlaylistName, c.Cfg.PlaylistID = previousName, previousID }()
+
+	c.SetPlaylist(name)
+	return c.API.SearchPlaylist() == nil && c.Cfg.PlaylistID != ""
+}
+
+func (c *Client) RefreshLibrary(ctx context.Context, tracks []*models.Track) error { // Scan library and search for newly added tracks
 	if c.System == "" {
 		log.Fatal("could not get music system")
 	}
 
-	if err := c.API.RefreshLibrary(); err != nil {
-		return fmt.Errorf("[%s] failed to schedule a library scan: %s", c.System, err.Error())
+	var deadline time.Time // search for missing tracks until then, regardless of SEARCH_RETRIES
+	if !c.refreshPaths(tracks) {
+		if err := c.API.RefreshLibrary(); err != nil {
+			return fmt.Errorf("[%s] failed to schedule a library scan: %s", c.System, err.Error())
+		}
+		log.Printf("[%s] Refreshing library...", c.System)
+	} else if delayed, ok := c.API.(DelayedRefresher); ok { // no scan is running until the files are imported
+		if c.Cfg.ScanInterval > 0 {
+			deadline = time.Now().Add(time.Duration(c.Cfg.ScanTimeout) * time.Minute)
+		}
+		log.Printf("[%s] waiting %s for the files to be imported", c.System, delayed.RefreshDelay())
+		if err := wait(ctx, delayed.RefreshDelay()); err != nil {
+			return err
+		}
+	}
+
+	if err := c.waitForScan(ctx); err != nil {
+		return err
 	}
+	c.CheckTracks(tracks) // search newly added songs
 
-	log.Printf("[%s] Refreshing library...", c.System)
-	time.Sleep(time.Duration(c.Cfg.Sleep) * time.Minute)
-	if err := c.API.SearchSongs(tracks); err != nil { // search newly added songs
-		log.Printf("warning: SearchSongs failed: %v", err)
+	for i := 0; i < c.Cfg.SearchRetries || time.Now().Before(deadline); i++ { // the system may still be indexing some files after the scan
+		var missing []*models.Track
+		for _, track := range tracks {
+			if !track.Present {
+				missing = append(missing, track)
+			}
+		}
+		if len(missing) == 0 {
+			break
+		}
+
+		log.Printf("[%s] %d tracks not found yet, searching again in %d seconds", c.System, len(missing), c.Cfg.ScanInterval)
+		if err := wait(ctx, time.Duration(c.Cfg.ScanInterval)*time.Second); err != nil {
+			return err
+		}
+		c.CheckTracks(missing)
+	}
+	return nil
+}
+
+func (c *Client) refreshPaths(tracks []*models.Track) bool { // with REFRESH_MODE=path, scan only downloaded files. False if the full library should be scanned
+	if c.Cfg.RefreshMode != "path" {
+		return false
+	}
+	refresher, ok := c.API.(PathRefresher)
+	if !ok {
+		log.Printf("[%s] path refresh isn't supported, refreshing the full library", c.System)
+		return false
+	}
+
+	var paths []string
+	for _, track := range tracks {
+		if track.Path != "" {
+			paths = append(paths, c.systemPath(track.Path))
+		}
+	}
+	if len(paths) == 0 {
+		return false
+	}
+
+	if err := refresher.RefreshPaths(paths); err != nil {
+		log.Printf("[%s] path refresh failed, refreshing the full library: %s", c.System, err.Error())
+		return false
+	}
+	log.Printf("[%s] Refreshing %d downloaded files...", c.System, len(paths))
+	return true
+}
+
+func (c *Client) systemPath(path string) string { // map a path under DOWNLOAD_DIR to SYSTEM_DOWNLOAD_DIR
+	if c.Cfg.SystemDownloadDir == "" {
+		return path
+	}
+	rel, err := filepath.Rel(c.Cfg.DownloadDir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return filepath.Join(c.Cfg.SystemDownloadDir, rel)
+}
+
+func (c *Client) downloadPath(systemPath string) (string, bool, error) { // map a path reported by the system to DOWNLOAD_DIR, false if it's not a download
+	dir := strings.ReplaceAll(c.Cfg.SystemDownloadDir, `\`, "/") // the system may run on Windows
+	if dir == "" {
+		dir = c.Cfg.DownloadDir
+	}
+	path := strings.ReplaceAll(systemPath, `\`, "/")
+
+	switch {
+	case isAbs(path) && !isAbs(dir):
+		return "", false, fmt.Errorf("can't map %s to DOWNLOAD_DIR, SYSTEM_DOWNLOAD_DIR should be the absolute path the system sees", systemPath)
+	case !isAbs(path) && isAbs(dir): // relative to the library folder's root, which is DOWNLOAD_DIR unless SYSTEM_DOWNLOAD_DIR is relative to it
+		if filepath.IsLocal(path) {
+			return filepath.Join(c.Cfg.DownloadDir, path), true, nil
+		}
+		return "", false, fmt.Errorf("can't map %s to DOWNLOAD_DIR", systemPath)
 	}
+
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", false, nil
+	}
+	return filepath.Join(c.Cfg.DownloadDir, rel), true, nil
+}
+
+func isAbs(path string) bool { // absolute on Linux or Windows, with forward slashes
+	return strings.HasPrefix(path, "/") || (len(path) > 2 && path[1] == ':' && path[2] == '/')
+}
+
+func (c *Client) waitForScan(ctx context.Context) error { // poll the scan status until it's done, sleep SLEEP minutes if it can't be read
+	sleep := time.Duration(c.Cfg.Sleep) * time.Minute
+	if c.Cfg.ScanTimeout <= 0 || c.Cfg.ScanInterval <= 0 {
+		return wait(ctx, sleep)
+	}
+
+	started := time.Now()
+	timeout := time.Duration(c.Cfg.ScanTimeout) * time.Minute
+	for {
+		if err := wait(ctx, time.Duration(c.Cfg.ScanInterval)*time.Second); err != nil { // give the system time to queue the scan before the first check
+			return err
+		}
+
+		scanning, err := c.API.ScanStatus()
+		if err != nil {
+			log.Printf("[%s] failed to get library scan status, waiting %d minutes instead: %s", c.System, c.Cfg.Sleep, err.Error())
+			return wait(ctx, sleep-time.Since(started))
+		}
+		if !scanning {
+			debug.Debug(fmt.Sprintf("[%s] library scan finished after %s", c.System, time.Since(started).Round(time.Second)))
+			return nil
+		}
+		if time.Since(started) >= timeout {
+			log.Printf("[%s] library scan didn't finish in %d minutes, searching for tracks anyway", c.System, c.Cfg.ScanTimeout)
+			return nil
+		}
+	}
+}
+
+func wait(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Client) CreatePlaylist(tracks []*models.Track, description string) error {
 	if err := c.API.CreatePlaylist(tracks); err != nil {
 		return fmt.Errorf("[%s] failed to create playlist: %s", c.System, err.Error())
 	}
 
-	description := "Created by Explo using recommendations from ListenBrainz"
 	if err := c.API.UpdatePlaylist(description); err != nil {
 		return fmt.Errorf("[%s] failed to update playlist: %s", c.System, err.Error())
 	}
@@ -160,3 +442,32 @@ func (c *Client) DeletePlaylist() error {
 	}
 	return nil
 }
+
+func hasMBID(providerIDs map[string]string, mbid string) bool { // check if any MusicBrainz provider ID matches the given MBID
+	if mbid == "" {
+		return false
+	}
+	for provider, id := range providerIDs {
+		if strings.HasPrefix(provider, "MusicBrainz") && strings.EqualFold(id, mbid) {
+			return true
+		}
+	}
+	return false
+}
+
+func rankArtists(artists []string, limit int) []string { // unique artists in the order given, up to limit
+	seen := make(map[string]bool)
+	ranked := make([]string, 0, limit)
+	for _, artist := range artists {
+		key := strings.ToLower(artist)
+		if artist == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		ranked = append(ranked, artist)
+		if len(ranked) >= limit {
+			break
+		}
+	}
+	return ranked
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"explo/src/config"
+)
+
+// fakeLikes reports liked tracks, the other APIClient methods aren't called
+type fakeLikes struct {
+	APIClient
+	tracks []LikedTrack
+}
+
+func (f *fakeLikes) LikedTracks() ([]LikedTrack, error) {
+	return f.tracks, nil
+}
+
+func TestLikedFiles(t *testing.T) {
+	tests := []struct {
+		name      string
+		systemDir string
+		path      string
+		want      []string
+		wantErr   string
+	}{
+		{name: "absolute", systemDir: "/music/explo", path: "/music/explo/Portishead/Roads.mp3", want: []string{"/data/explo/Portishead/Roads.mp3"}},
+		{name: "absolute outside", systemDir: "/music/explo", path: "/music/library/Roads.mp3"},
+		{name: "windows", systemDir: `C:\Music\explo`, path: `C:\Music\explo\Roads.mp3`, want: []string{"/data/explo/Roads.mp3"}},
+		{name: "same dir", path: "/data/explo/Roads.mp3", want: []string{"/data/explo/Roads.mp3"}},
+		{name: "relative to download dir", path: "Portishead/Roads.mp3", want: []string{"/data/explo/Portishead/Roads.mp3"}},
+		{name: "relative to absolute system dir", systemDir: "/music/explo", path: "Roads.mp3", want: []string{"/data/explo/Roads.mp3"}},
+		{name: "relative system dir", systemDir: "explo/", path: "explo/Portishead/Roads.mp3", want: []string{"/data/explo/Portishead/Roads.mp3"}},
+		{name: "relative outside", systemDir: "explo/", path: "library/Roads.mp3"},
+		{name: "relative escaping", path: "../library/Roads.mp3", wantErr: "can't map ../library/Roads.mp3"},
+		{name: "absolute with relative system dir", systemDir: "explo/", path: "/music/explo/Roads.mp3", wantErr: "can't map /music/explo/Roads.mp3"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.ClientConfig{DownloadDir: "/data/explo/", SystemDownloadDir: test.systemDir, Keep: []string{"favorite"}}
+			c := &Client{System: "subsonic", Cfg: cfg, API: &fakeLikes{tracks: []LikedTrack{
+				{Path: test.path, Favorite: true},
+				{Path: "/music/explo/not-liked.mp3"},
+			}}}
+
+			files, err := c.LikedFiles()
+			switch {
+			case test.wantErr == "" && err != nil:
+				t.Fatalf("LikedFiles: %s", err.Error())
+			case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+				t.Fatalf("got error %v, want %q", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(files, test.want) {
+				t.Errorf("got %q, want %q", files, test.want)
+			}
+		})
+	}
+}
@@ -35,6 +35,27 @@ type EmbyItems struct {
 	Album             string          `json:"Album,omitempty"`
 	AlbumArtist       string          `json:"AlbumArtist,omitempty"`
 	Artists           []string  	  `json:"Artists"`
+	ProviderIds       map[string]string `json:"ProviderIds"`
+	UserData          EmbyUserData `json:"UserData"`
+}
+
+type EmbyUserData struct {
+	IsFavorite bool    `json:"IsFavorite"`
+	PlayCount  int     `json:"PlayCount"`
+	Rating     float64 `json:"Rating"` // out of 10
+}
+
+type EmbyUser struct {
+	Name   string `json:"Name"`
+	ID     string `json:"Id"`
+	Policy struct {
+		IsAdministrator bool `json:"IsAdministrator"`
+	} `json:"Policy"`
+}
+
+type EmbyTasks []struct {
+	Key   string `json:"Key"`
+	State string `json:"State"`
 }
 
 type EmbyPlaylist struct {
@@ -43,11 +64,12 @@ type EmbyPlaylist struct {
 
 type Emby struct {
 	LibraryID string
+	UserID string
 	HttpClient *util.HttpClient
-	Cfg config.ClientConfig
+	Cfg *config.ClientConfig
 }
 
-func NewEmby(cfg config.ClientConfig, httpClient *util.HttpClient) *Emby {
+func NewEmby(cfg *config.ClientConfig, httpClient *util.HttpClient) *Emby {
 	return &Emby{Cfg: cfg,
 	HttpClient: httpClient}
 }
@@ -121,9 +143,57 @@ func (c *Emby) RefreshLibrary() error {
 	return nil
 }
 
+func (c *Emby) RefreshPaths(paths []string) error { // report new files, the server scans them after its library monitor delay
+	payload, err := mediaUpdates(paths)
+	if err != nil {
+		return err
+	}
+	if _, err := c.HttpClient.MakeRequest("POST", c.Cfg.URL+"/emby/Library/Media/Updated", bytes.NewReader(payload), c.Cfg.Creds.Headers); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Emby) RefreshDelay() time.Duration {
+	return libraryMonitorDelay
+}
+
+func (c *Emby) ScanStatus() (bool, error) { // true while the library is queued or refreshing, or a full library scan runs
+	body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+"/emby/Library/VirtualFolders", nil, c.Cfg.Creds.Headers)
+	if err != nil {
+		return false, err
+	}
+
+	var paths EmbyPaths
+	if err = util.ParseResp(body, &paths); err != nil {
+		return false, err
+	}
+	for _, path := range paths {
+		if path.ItemID == c.LibraryID && path.RefreshStatus != "" && path.RefreshStatus != "Idle" {
+			return true, nil
+		}
+	}
+
+	body, err = c.HttpClient.MakeRequest("GET", c.Cfg.URL+"/emby/ScheduledTasks?IsHidden=false", nil, c.Cfg.Creds.Headers)
+	if err != nil {
+		return false, err
+	}
+
+	var tasks EmbyTasks
+	if err = util.ParseResp(body, &tasks); err != nil {
+		return false, err
+	}
+	for _, task := range tasks {
+		if task.Key == "RefreshLibrary" && task.State != "Idle" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func (c *Emby) SearchSongs(tracks []*models.Track) error {
 	for _, track := range tracks {
-		reqParam := fmt.Sprintf("/Items?IncludeMediaTypes=Audio&SearchTerm=%s&Recursive=true&Fields=Path", url.QueryEscape(track.CleanTitle))
+		reqParam := fmt.Sprintf("/Items?IncludeMediaTypes=Audio&SearchTerm=%s&Recursive=true&Fields=Path,ProviderIds", url.QueryEscape(track.CleanTitle))
 
 		body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+reqParam, nil, c.Cfg.Creds.Headers)
 		if err != nil {
@@ -136,8 +206,14 @@ func (c *Emby) SearchSongs(tracks []*models.Track) error {
 		}
 
 		for _, item := range results.Items {
+			if hasMBID(item.ProviderIds, track.RecordingMBID) {
+				track.LibraryID = item.ID
+				track.Present = true
+				break
+			}
+
 			if strings.EqualFold(track.MainArtist, item.AlbumArtist) && (strings.EqualFold(item.Name, track.CleanTitle) || strings.Contains(strings.ToLower(item.Path), strings.ToLower(track.File))) {
-				track.ID = item.ID
+				track.LibraryID = item.ID
 				track.Present = true
 				break
 			}
@@ -145,7 +221,7 @@ func (c *Emby) SearchSongs(tracks []*models.Track) error {
 			if track.File != "" && len(item.Artists) > 0 &&
 				strings.Contains(strings.ToLower(item.Artists[0]), strings.ToLower(track.MainArtist)) &&
 				strings.Contains(strings.ToLower(item.Path), strings.ToLower(track.File)) {
-				track.ID = item.ID
+				track.LibraryID = item.ID
 				track.Present = true
 				break
 			}
@@ -158,8 +234,69 @@ func (c *Emby) SearchSongs(tracks []*models.Track) error {
 	return nil
 }
 
+func (c *Emby) GetTopArtists(limit int) ([]string, error) {
+	userID, err := c.getUserID()
+	if err != nil {
+		return nil, err
+	}
+
+	reqParam := fmt.Sprintf("/emby/Users/%s/Items?IncludeItemTypes=Audio&Recursive=true&Filters=IsPlayed&SortBy=PlayCount,DatePlayed&SortOrder=Descending&Limit=500", userID)
+	body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+reqParam, nil, c.Cfg.Creds.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	var results EmbyItemSearch
+	if err = util.ParseResp(body, &results); err != nil {
+		return nil, err
+	}
+
+	artists := make([]string, 0, len(results.Items))
+	for _, item := range results.Items {
+		if item.AlbumArtist != "" {
+			artists = append(artists, item.AlbumArtist)
+		} else if len(item.Artists) > 0 {
+			artists = append(artists, item.Artists[0])
+		}
+	}
+	return rankArtists(artists, limit), nil
+}
+
+func (c *Emby) LikedTracks() ([]LikedTrack, error) { // tracks in the Explo library with the user's data
+	userID, err := c.getUserID()
+	if err != nil {
+		return nil, err
+	}
+
+	reqParam := fmt.Sprintf("/emby/Users/%s/Items?ParentId=%s&IncludeItemTypes=Audio&Recursive=true&Fields=Path", userID, c.LibraryID)
+	body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+reqParam, nil, c.Cfg.Creds.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	var results EmbyItemSearch
+	if err = util.ParseResp(body, &results); err != nil {
+		return nil, err
+	}
+
+	tracks := make([]LikedTrack, 0, len(results.Items))
+	for _, item := range results.Items {
+		tracks = append(tracks, LikedTrack{
+			Path:     item.Path,
+			Favorite: item.UserData.IsFavorite,
+			Rating:   int(item.UserData.Rating / 2),
+			Plays:    item.UserData.PlayCount,
+		})
+	}
+	return tracks, nil
+}
+
 func (c *Emby) SearchPlaylist() error {
-	params := fmt.Sprintf("/emby/Items?SearchTerm=%s&Recursive=true&IncludeItemTypes=Playlist", c.Cfg.PlaylistName)
+	userID, err := c.getUserID()
+	if err != nil {
+		return err
+	}
+	params := fmt.Sprintf("/emby/Users/%s/Items?SearchTerm=%s&Recursive=true&IncludeItemTypes=Playlist", userID, c.Cfg.PlaylistName) // only the user's playlists
 
 	body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+params, nil, c.Cfg.Creds.Headers)
 	if err != nil {
@@ -181,8 +318,12 @@ func (c *Emby) SearchPlaylist() error {
 
 func (c *Emby) CreatePlaylist(tracks []*models.Track) error {
 	songIDs := formatEmbySongs(tracks)
+	userID, err := c.getUserID() // owner of the playlist
+	if err != nil {
+		return err
+	}
 
-	reqParam := fmt.Sprintf("/emby/Playlists?Name=%s&Ids=%s&MediaType=Music", c.Cfg.PlaylistName, songIDs)
+	reqParam := fmt.Sprintf("/emby/Playlists?Name=%s&Ids=%s&MediaType=Music&UserId=%s", c.Cfg.PlaylistName, songIDs, userID)
 
 
 	body, err := c.HttpClient.MakeRequest("POST", c.Cfg.URL+reqParam, nil, c.Cfg.Creds.Headers)
@@ -224,11 +365,35 @@ func (c *Emby) DeletePlaylist() error { // Doesn't currently work due to a bug i
 	return nil
 }
 
+func (c *Emby) getUserID() (string, error) { // get ID of SYSTEM_USERNAME, or the first admin if it's not set
+	if c.UserID != "" {
+		return c.UserID, nil
+	}
+
+	body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+"/emby/Users", nil, c.Cfg.Creds.Headers)
+	if err != nil {
+		return "", err
+	}
+
+	var users []EmbyUser
+	if err = util.ParseResp(body, &users); err != nil {
+		return "", err
+	}
+
+	for _, user := range users {
+		if (c.Cfg.Creds.User != "" && strings.EqualFold(user.Name, c.Cfg.Creds.User)) || (c.Cfg.Creds.User == "" && user.Policy.IsAdministrator) {
+			c.UserID = user.ID
+			return c.UserID, nil
+		}
+	}
+	return "", fmt.Errorf("failed to find Emby user %s", c.Cfg.Creds.User)
+}
+
 func formatEmbySongs(tracks []*models.Track) string {
 	songIDs := make([]string, 0, len(tracks))
 	for _, track := range tracks {
 		if track.Present {
-			songIDs = append(songIDs,track.ID)
+			songIDs = append(songIDs,track.LibraryID)
 		}
 	}
 	songs := strings.Join(songIDs, ",")
@@ -0,0 +1,344 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"explo/src/config"
+	"explo/src/debug"
+	"explo/src/models"
+	"explo/src/util"
+)
+
+type FWArtist struct {
+	Name string `json:"name"`
+}
+
+type FWTracks struct {
+	Results []struct {
+		ID           int      `json:"id"`
+		Title        string   `json:"title"`
+		MBID         string   `json:"mbid"`
+		Artist       FWArtist `json:"artist"`
+		ArtistCredit []struct {
+			Artist FWArtist `json:"artist"`
+		} `json:"artist_credit"` // replaces artist since Funkwhale 2.0
+	} `json:"results"`
+}
+
+type FWLibraries struct {
+	Results []struct {
+		UUID string `json:"uuid"`
+		Name string `json:"name"`
+	} `json:"results"`
+}
+
+type FWPlaylists struct {
+	Results []FWPlaylist `json:"results"`
+}
+
+type FWPlaylist struct {
+	ID   int    `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+type FWListenings struct {
+	Results []struct {
+		Track struct {
+			Artist       FWArtist `json:"artist"`
+			ArtistCredit []struct {
+				Artist FWArtist `json:"artist"`
+			} `json:"artist_credit"`
+		} `json:"track"`
+	} `json:"results"`
+}
+
+// Funkwhale uses the REST API with an application token. Files are uploaded to the library in REFRESH_MODE=path,
+// otherwise they have to be imported in place on the server (import_files --in-place --watch)
+type Funkwhale struct {
+	LibraryID  string
+	HttpClient *util.HttpClient
+	Cfg        *config.ClientConfig
+}
+
+func NewFunkwhale(cfg *config.ClientConfig, httpClient *util.HttpClient) *Funkwhale {
+	return &Funkwhale{Cfg: cfg,
+		HttpClient: httpClient}
+}
+
+func (c *Funkwhale) AddHeader() error {
+	if c.Cfg.Creds.Headers == nil {
+		c.Cfg.Creds.Headers = make(map[string]string)
+	}
+
+	if c.Cfg.Creds.APIKey != "" {
+		c.Cfg.Creds.Headers["Authorization"] = "Bearer " + c.Cfg.Creds.APIKey
+		return nil
+	}
+	return fmt.Errorf("API_KEY not set")
+}
+
+func (c *Funkwhale) GetAuth() error {
+	return nil
+}
+
+func (c *Funkwhale) GetLibrary() error {
+	body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+"/api/v1/libraries/?scope=me&page_size=100", nil, c.Cfg.Creds.Headers)
+	if err != nil {
+		return err
+	}
+
+	var libraries FWLibraries
+	if err = util.ParseResp(body, &libraries); err != nil {
+		return err
+	}
+	for _, library := range libraries.Results {
+		if library.Name == c.Cfg.LibraryName {
+			c.LibraryID = library.UUID
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to find library named %s", c.Cfg.LibraryName)
+}
+
+func (c *Funkwhale) AddLibrary() error {
+	return nil
+}
+
+func (c *Funkwhale) SearchSongs(tracks []*models.Track) error {
+	for _, track := range tracks {
+		reqParam := fmt.Sprintf("/api/v1/tracks/?q=%s&page_size=50", url.QueryEscape(track.CleanTitle))
+		body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+reqParam, nil, c.Cfg.Creds.Headers)
+		if err != nil {
+			debug.Debug(fmt.Sprintf("failed to search for '%s': %s", track.Title, err.Error()))
+			continue
+		}
+
+		var results FWTracks
+		if err = util.ParseResp(body, &results); err != nil {
+			debug.Debug(fmt.Sprintf("failed to parse results for '%s': %s", track.Title, err.Error()))
+			continue
+		}
+
+		for _, result := range results.Results {
+			artist := result.Artist.Name
+			if len(result.ArtistCredit) > 0 {
+				artist = result.ArtistCredit[0].Artist.Name
+			}
+			mbidMatch := track.RecordingMBID != "" && strings.EqualFold(result.MBID, track.RecordingMBID)
+			if mbidMatch || (strings.EqualFold(result.Title, track.CleanTitle) && strings.Contains(strings.ToLower(artist), strings.ToLower(track.MainArtist))) {
+				track.LibraryID = strconv.Itoa(result.ID)
+				track.Present = true
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Funkwhale) GetTopArtists(limit int) ([]string, error) { // most listened artists in the user's history
+	reqParam := fmt.Sprintf("/api/v1/history/listenings/?scope=me&page_size=%d", limit*10)
+	body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+reqParam, nil, c.Cfg.Creds.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	var listenings FWListenings
+	if err = util.ParseResp(body, &listenings); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	var artists []string
+	for _, listening := range listenings.Results {
+		artist := listening.Track.Artist.Name
+		if len(listening.Track.ArtistCredit) > 0 {
+			artist = listening.Track.ArtistCredit[0].Artist.Name
+		}
+		if counts[artist] == 0 {
+			artists = append(artists, artist)
+		}
+		counts[artist]++
+	}
+	slices.SortStableFunc(artists, func(a, b string) int { return counts[b] - counts[a] })
+	return rankArtists(artists, limit), nil
+}
+
+func (c *Funkwhale) RefreshLibrary() error { // in-place imports are done on the server, there's no API to start one
+	return nil
+}
+
+func (c *Funkwhale) RefreshPaths(paths []string) error { // upload downloaded files to the library, SYSTEM_DOWNLOAD_DIR has to be unset so paths are local
+	for _, path := range paths {
+		if err := c.upload(path); err != nil {
+			return fmt.Errorf("failed to upload %s: %s", path, err.Error())
+		}
+	}
+	return nil
+}
+
+func (c *Funkwhale) ScanStatus() (bool, error) { // true while uploads are waiting to be imported
+	reqParam := fmt.Sprintf("/api/v1/uploads/?library=%s&import_status=pending&page_size=1", c.LibraryID)
+	body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+reqParam, nil, c.Cfg.Creds.Headers)
+	if err != nil {
+		return false, err
+	}
+
+	var pending struct {
+		Count int `json:"count"`
+	}
+	if err = util.ParseResp(body, &pending); err != nil {
+		return false, err
+	}
+	return pending.Count > 0, nil
+}
+
+func (c *Funkwhale) CreatePlaylist(tracks []*models.Track) error { // Funkwhale allows duplicate names, so a playlist of the same name is cleared and reused
+	if err := c.SearchPlaylist(); err != nil {
+		return err
+	}
+	if c.Cfg.PlaylistID != "" {
+		reqParam := fmt.Sprintf("/api/v1/playlists/%s/clear/", c.Cfg.PlaylistID)
+		if _, err := c.HttpClient.MakeRequest("DELETE", c.Cfg.URL+reqParam, nil, c.Cfg.Creds.Headers); err != nil {
+			return fmt.Errorf("failed to clear existing playlist: %s", err.Error())
+		}
+	} else if err := c.newPlaylist(); err != nil {
+		return err
+	}
+
+	var ids []int
+	for _, track := range tracks {
+		if id, err := strconv.Atoi(track.LibraryID); err == nil && track.Present {
+			ids = append(ids, id)
+		}
+	}
+	payload, err := json.Marshal(map[string]any{"tracks": ids, "allow_duplicates": false})
+	if err != nil {
+		return err
+	}
+
+	reqParam := fmt.Sprintf("/api/v1/playlists/%s/add/", c.Cfg.PlaylistID)
+	if _, err := c.HttpClient.MakeRequest("POST", c.Cfg.URL+reqParam, bytes.NewReader(payload), c.Cfg.Creds.Headers); err != nil {
+		return fmt.Errorf("failed to add tracks: %s", err.Error())
+	}
+	return nil
+}
+
+func (c *Funkwhale) newPlaylist() error {
+	payload, err := json.Marshal(map[string]string{"name": c.Cfg.PlaylistName, "privacy_level": "me"})
+	if err != nil {
+		return err
+	}
+
+	body, err := c.HttpClient.MakeRequest("POST", c.Cfg.URL+"/api/v1/playlists/", bytes.NewReader(payload), c.Cfg.Creds.Headers)
+	if err != nil {
+		return err
+	}
+
+	var playlist FWPlaylist
+	if err = util.ParseResp(body, &playlist); err != nil {
+		return err
+	}
+	c.Cfg.PlaylistID = strconv.Itoa(playlist.ID)
+	return nil
+}
+
+func (c *Funkwhale) SearchPlaylist() error {
+	reqParam := fmt.Sprintf("/api/v1/playlists/?scope=me&name=%s", url.QueryEscape(c.Cfg.PlaylistName))
+	body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+reqParam, nil, c.Cfg.Creds.Headers)
+	if err != nil {
+		return err
+	}
+
+	var playlists FWPlaylists
+	if err = util.ParseResp(body, &playlists); err != nil {
+		return err
+	}
+	for _, playlist := range playlists.Results {
+		if playlist.Name == c.Cfg.PlaylistName {
+			c.Cfg.PlaylistID = strconv.Itoa(playlist.ID)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (c *Funkwhale) UpdatePlaylist(description string) error { // description is only kept by Funkwhale 2.0 and later
+	payload, err := json.Marshal(map[string]string{"name": c.Cfg.PlaylistName, "description": description})
+	if err != nil {
+		return err
+	}
+
+	reqParam := fmt.Sprintf("/api/v1/playlists/%s/", c.Cfg.PlaylistID)
+	if _, err := c.HttpClient.MakeRequest("PATCH", c.Cfg.URL+reqParam, bytes.NewReader(payload), c.Cfg.Creds.Headers); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Funkwhale) DeletePlaylist() error {
+	reqParam := fmt.Sprintf("/api/v1/playlists/%s/", c.Cfg.PlaylistID)
+
+	if _, err := c.HttpClient.MakeRequest("DELETE", c.Cfg.URL+reqParam, nil, c.Cfg.Creds.Headers); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Funkwhale) upload(path string) error { // multipart upload, MakeRequest only sends JSON
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	if err := writer.WriteField("library", c.LibraryID); err != nil {
+		return err
+	}
+	if err := writer.WriteField("import_reference", "explo"); err != nil {
+		return err
+	}
+	part, err := writer.CreateFormFile("audio_file", filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", c.Cfg.URL+"/api/v1/uploads/", &form)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", c.Cfg.Creds.Headers["Authorization"])
+
+	uploader := &http.Client{Timeout: 10 * time.Minute} // the shared client times out before big files are sent
+	resp, err := uploader.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		debug.Debug(fmt.Sprintf("full response: %s", string(body)))
+		return fmt.Errorf("got %d from %s", resp.StatusCode, req.URL)
+	}
+	return nil
+}
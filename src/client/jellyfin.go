@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"time"
 
 	"explo/src/config"
 	"explo/src/debug"
@@ -48,7 +49,35 @@ type Items struct {
 	Album       string   `json:"Album,omitempty"`
 	AlbumArtist string   `json:"AlbumArtist,omitempty"`
 	Artists     []string `json:"Artists"`
+	ProviderIds map[string]string `json:"ProviderIds"`
+	UserData    JFUserData `json:"UserData"`
+}
+
+type JFUserData struct {
+	IsFavorite bool    `json:"IsFavorite"`
+	PlayCount  int     `json:"PlayCount"`
+	Rating     float64 `json:"Rating"` // out of 10
+}
+
+type JFUser struct {
+	Name   string `json:"Name"`
+	ID     string `json:"Id"`
+	Policy struct {
+		IsAdministrator bool `json:"IsAdministrator"`
+	} `json:"Policy"`
+}
+
+type MediaUpdates struct {
+	Updates []MediaUpdate `json:"Updates"`
+}
+type MediaUpdate struct {
+	Path       string `json:"Path"`
+	UpdateType string `json:"UpdateType"`
+}
 
+type Tasks []struct {
+	Key   string `json:"Key"`
+	State string `json:"State"`
 }
 
 type JFPlaylist struct {
@@ -57,11 +86,12 @@ type JFPlaylist struct {
 
 type Jellyfin struct {
 	LibraryID  string
+	UserID     string
 	HttpClient *util.HttpClient
-	Cfg        config.ClientConfig
+	Cfg        *config.ClientConfig
 }
 
-func NewJellyfin(cfg config.ClientConfig, httpClient *util.HttpClient) *Jellyfin {
+func NewJellyfin(cfg *config.ClientConfig, httpClient *util.HttpClient) *Jellyfin {
 	return &Jellyfin{Cfg: cfg,
 		HttpClient: httpClient}
 }
@@ -130,9 +160,67 @@ func (c *Jellyfin) RefreshLibrary() error {
 	return nil
 }
 
+func (c *Jellyfin) RefreshPaths(paths []string) error { // report new files, the server scans them after its library monitor delay
+	payload, err := mediaUpdates(paths)
+	if err != nil {
+		return err
+	}
+	if _, err := c.HttpClient.MakeRequest("POST", c.Cfg.URL+"/Library/Media/Updated", bytes.NewReader(payload), c.Cfg.Creds.Headers); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Jellyfin) RefreshDelay() time.Duration {
+	return libraryMonitorDelay
+}
+
+const libraryMonitorDelay = 60 * time.Second // default LibraryMonitorDelay of Jellyfin and Emby
+
+func mediaUpdates(paths []string) ([]byte, error) { // Library/Media/Updated payload, shared with Emby
+	var updates MediaUpdates
+	for _, path := range paths {
+		updates.Updates = append(updates.Updates, MediaUpdate{Path: path, UpdateType: "Created"})
+	}
+	return json.Marshal(updates)
+}
+
+func (c *Jellyfin) ScanStatus() (bool, error) { // true while the library is queued or refreshing, or a full library scan runs
+	body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+"/Library/VirtualFolders", nil, c.Cfg.Creds.Headers)
+	if err != nil {
+		return false, err
+	}
+
+	var paths Paths
+	if err = util.ParseResp(body, &paths); err != nil {
+		return false, err
+	}
+	for _, path := range paths {
+		if path.ItemID == c.LibraryID && path.RefreshStatus != "" && path.RefreshStatus != "Idle" {
+			return true, nil
+		}
+	}
+
+	body, err = c.HttpClient.MakeRequest("GET", c.Cfg.URL+"/ScheduledTasks?isHidden=false", nil, c.Cfg.Creds.Headers)
+	if err != nil {
+		return false, err
+	}
+
+	var tasks Tasks
+	if err = util.ParseResp(body, &tasks); err != nil {
+		return false, err
+	}
+	for _, task := range tasks {
+		if task.Key == "RefreshLibrary" && task.State != "Idle" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func (c *Jellyfin) SearchSongs(tracks []*models.Track) error {
 	for _, track := range tracks {
-		reqParam := fmt.Sprintf("/Items?IncludeMediaTypes=Audio&SearchTerm=%s&Recursive=true&Fields=Path", url.QueryEscape(track.CleanTitle))
+		reqParam := fmt.Sprintf("/Items?IncludeMediaTypes=Audio&SearchTerm=%s&Recursive=true&Fields=Path,ProviderIds", url.QueryEscape(track.CleanTitle))
 
 		body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+reqParam, nil, c.Cfg.Creds.Headers)
 		if err != nil {
@@ -145,8 +233,14 @@ func (c *Jellyfin) SearchSongs(tracks []*models.Track) error {
 		}
 
 		for _, item := range results.Items {
+			if hasMBID(item.ProviderIds, track.RecordingMBID) {
+				track.LibraryID = item.ID
+				track.Present = true
+				break
+			}
+
 			if strings.EqualFold(track.MainArtist, item.AlbumArtist) && (strings.EqualFold(item.Name, track.CleanTitle) || strings.Contains(strings.ToLower(item.Path), strings.ToLower(track.File))) {
-				track.ID = item.ID
+				track.LibraryID = item.ID
 				track.Present = true
 				break
 			}
@@ -154,7 +248,7 @@ func (c *Jellyfin) SearchSongs(tracks []*models.Track) error {
 			if track.File != "" && len(item.Artists) > 0 &&
 				strings.Contains(strings.ToLower(item.Artists[0]), strings.ToLower(track.MainArtist)) &&
 				strings.Contains(strings.ToLower(item.Path), strings.ToLower(track.File)) {
-				track.ID = item.ID
+				track.LibraryID = item.ID
 				track.Present = true
 				break
 			}
@@ -167,8 +261,70 @@ func (c *Jellyfin) SearchSongs(tracks []*models.Track) error {
 	return nil
 }
 
+func (c *Jellyfin) GetTopArtists(limit int) ([]string, error) {
+	userID, err := c.getUserID()
+	if err != nil {
+		return nil, err
+	}
+
+	reqParam := fmt.Sprintf("/Items?userId=%s&IncludeItemTypes=Audio&Recursive=true&Filters=IsPlayed&SortBy=PlayCount,DatePlayed&SortOrder=Descending&Limit=500", userID)
+	body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+reqParam, nil, c.Cfg.Creds.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	var results Audios
+	if err = util.ParseResp(body, &results); err != nil {
+		return nil, err
+	}
+
+	artists := make([]string, 0, len(results.Items))
+	for _, item := range results.Items {
+		if item.AlbumArtist != "" {
+			artists = append(artists, item.AlbumArtist)
+		} else if len(item.Artists) > 0 {
+			artists = append(artists, item.Artists[0])
+		}
+	}
+	return rankArtists(artists, limit), nil
+}
+
+func (c *Jellyfin) LikedTracks() ([]LikedTrack, error) { // tracks in the Explo library with the user's data
+	userID, err := c.getUserID()
+	if err != nil {
+		return nil, err
+	}
+
+	reqParam := fmt.Sprintf("/Items?userId=%s&ParentId=%s&IncludeItemTypes=Audio&Recursive=true&Fields=Path&EnableUserData=true", userID, c.LibraryID)
+	body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+reqParam, nil, c.Cfg.Creds.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	var results Audios
+	if err = util.ParseResp(body, &results); err != nil {
+		return nil, err
+	}
+
+	tracks := make([]LikedTrack, 0, len(results.Items))
+	for _, item := range results.Items {
+		tracks = append(tracks, LikedTrack{
+			Path:     item.Path,
+			Favorite: item.UserData.IsFavorite,
+			Rating:   int(item.UserData.Rating / 2),
+			Plays:    item.UserData.PlayCount,
+		})
+	}
+	return tracks, nil
+}
+
 func (c *Jellyfin) SearchPlaylist() error {
-	queryParams := fmt.Sprintf("/Items?mediaTypes=Playlist&searchTerm=%s&recursive=true", c.Cfg.PlaylistName)
+	userID, err := c.getUserID()
+	if err != nil {
+		return err
+	}
+
+	queryParams := fmt.Sprintf("/Items?mediaTypes=Playlist&searchTerm=%s&recursive=true&userId=%s", c.Cfg.PlaylistName, userID) // only the user's playlists, users can have playlists with the same name
 	body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+queryParams, nil, c.Cfg.Creds.Headers)
 	if err != nil {
 		return err
@@ -193,6 +349,10 @@ func (c *Jellyfin) CreatePlaylist(tracks []*models.Track) error {
 	if err != nil {
 		return fmt.Errorf("failed to marshal track IDs: %s", err.Error())
 	}
+	userID, err := c.getUserID() // owner of the playlist
+	if err != nil {
+		return err
+	}
 
 	queryParams := "/Playlists"
 	payload := fmt.Appendf(nil, `
@@ -201,7 +361,7 @@ func (c *Jellyfin) CreatePlaylist(tracks []*models.Track) error {
 		"Ids": %s,
 		"MediaType": "Audio",
 		"UserId": "%s"
-		}`, c.Cfg.PlaylistName, songs, c.Cfg.Creds.APIKey)
+		}`, c.Cfg.PlaylistName, songs, userID)
 
 	body, err := c.HttpClient.MakeRequest("POST", c.Cfg.URL+queryParams, bytes.NewReader(payload), c.Cfg.Creds.Headers)
 	if err != nil {
@@ -246,7 +406,7 @@ func formatJFSongs(tracks []*models.Track) ([]byte, error) { // marshal track ID
 	songIDs := make([]string, 0, len(tracks))
 	for _, track := range tracks {
 		if track.Present {
-			songIDs = append(songIDs, track.ID)
+			songIDs = append(songIDs, track.LibraryID)
 		}
 	}
 	songs, err := json.Marshal(songIDs)
@@ -255,3 +415,27 @@ func formatJFSongs(tracks []*models.Track) ([]byte, error) { // marshal track ID
 	}
 	return songs, nil
 }
+
+func (c *Jellyfin) getUserID() (string, error) { // get ID of SYSTEM_USERNAME, or the first admin if it's not set
+	if c.UserID != "" {
+		return c.UserID, nil
+	}
+
+	body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+"/Users", nil, c.Cfg.Creds.Headers)
+	if err != nil {
+		return "", err
+	}
+
+	var users []JFUser
+	if err = util.ParseResp(body, &users); err != nil {
+		return "", err
+	}
+
+	for _, user := range users {
+		if (c.Cfg.Creds.User != "" && strings.EqualFold(user.Name, c.Cfg.Creds.User)) || (c.Cfg.Creds.User == "" && user.Policy.IsAdministrator) {
+			c.UserID = user.ID
+			return c.UserID, nil
+		}
+	}
+	return "", fmt.Errorf("failed to find Jellyfin user %s", c.Cfg.Creds.User)
+}
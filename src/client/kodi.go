@@ -0,0 +1,240 @@
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"explo/src/config"
+	"explo/src/debug"
+	"explo/src/models"
+	"explo/src/util"
+)
+
+type KodiRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+	ID      int    `json:"id"`
+}
+
+type KodiResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type KodiSongs struct {
+	Songs []struct {
+		SongID             int      `json:"songid"`
+		Title              string   `json:"title"`
+		Artist             []string `json:"artist"`
+		File               string   `json:"file"`
+		Duration           int      `json:"duration"`
+		MusicBrainzTrackID string   `json:"musicbrainztrackid"`
+		UserRating         int      `json:"userrating"` // out of 10
+		PlayCount          int      `json:"playcount"`
+	} `json:"songs"`
+}
+
+// Kodi searches the music library over JSON-RPC and writes M3U playlists to PLAYLIST_DIR
+type Kodi struct {
+	HttpClient *util.HttpClient
+	Cfg        *config.ClientConfig
+}
+
+func NewKodi(cfg *config.ClientConfig, httpClient *util.HttpClient) *Kodi {
+	return &Kodi{Cfg: cfg,
+		HttpClient: httpClient}
+}
+
+func (c *Kodi) AddHeader() error { // Kodi's web server uses basic auth, if a password is set
+	if c.Cfg.Creds.Headers == nil {
+		c.Cfg.Creds.Headers = make(map[string]string)
+	}
+	if c.Cfg.Creds.User != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(c.Cfg.Creds.User + ":" + c.Cfg.Creds.Password))
+		c.Cfg.Creds.Headers["Authorization"] = "Basic " + auth
+	}
+	return nil
+}
+
+func (c *Kodi) GetAuth() error {
+	return nil
+}
+
+func (c *Kodi) GetLibrary() error { // check that the JSON-RPC API is reachable
+	var pong string
+	if err := c.kodiRequest("JSONRPC.Ping", nil, &pong); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Kodi) AddLibrary() error {
+	return nil
+}
+
+func (c *Kodi) SearchSongs(tracks []*models.Track) error {
+	for _, track := range tracks {
+		params := map[string]any{
+			"filter": map[string]any{
+				"and": []map[string]string{
+					{"field": "title", "operator": "is", "value": track.CleanTitle},
+					{"field": "artist", "operator": "is", "value": track.MainArtist},
+				},
+			},
+			"properties": []string{"title", "artist", "file", "duration", "musicbrainztrackid"},
+		}
+
+		var result KodiSongs
+		if err := c.kodiRequest("AudioLibrary.GetSongs", params, &result); err != nil {
+			debug.Debug(fmt.Sprintf("failed to search for '%s': %s", track.Title, err.Error()))
+			continue
+		}
+
+		for _, song := range result.Songs {
+			if track.LibraryID == "" || (track.RecordingMBID != "" && strings.EqualFold(song.MusicBrainzTrackID, track.RecordingMBID)) {
+				track.LibraryID = song.File // playlists reference files
+				track.Duration = song.Duration * 1000
+				track.Present = true
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Kodi) GetTopArtists(limit int) ([]string, error) {
+	params := map[string]any{
+		"properties": []string{"artist", "playcount"},
+		"sort":       map[string]string{"method": "playcount", "order": "descending"},
+		"limits":     map[string]int{"start": 0, "end": limit * 10}, // songs, several can be by the same artist
+	}
+
+	var result KodiSongs
+	if err := c.kodiRequest("AudioLibrary.GetSongs", params, &result); err != nil {
+		return nil, err
+	}
+
+	var artists []string
+	for _, song := range result.Songs {
+		artists = append(artists, song.Artist...)
+	}
+	return rankArtists(artists, limit), nil
+}
+
+func (c *Kodi) LikedTracks() ([]LikedTrack, error) { // songs in the download folder, Kodi has ratings but no favourites
+	dir := c.Cfg.SystemDownloadDir
+	if dir == "" {
+		dir = c.Cfg.DownloadDir
+	}
+	params := map[string]any{
+		"filter":     map[string]string{"field": "path", "operator": "startswith", "value": dir},
+		"properties": []string{"file", "userrating", "playcount"},
+	}
+
+	var result KodiSongs
+	if err := c.kodiRequest("AudioLibrary.GetSongs", params, &result); err != nil {
+		return nil, err
+	}
+
+	tracks := make([]LikedTrack, 0, len(result.Songs))
+	for _, song := range result.Songs {
+		tracks = append(tracks, LikedTrack{
+			Path:   song.File,
+			Rating: song.UserRating / 2,
+			Plays:  song.PlayCount,
+		})
+	}
+	return tracks, nil
+}
+
+func (c *Kodi) RefreshLibrary() error {
+	var result string
+	return c.kodiRequest("AudioLibrary.Scan", map[string]any{"showdialogs": false}, &result)
+}
+
+func (c *Kodi) ScanStatus() (bool, error) {
+	var result map[string]bool
+	if err := c.kodiRequest("XBMC.GetInfoBooleans", map[string]any{"booleans": []string{"Library.IsScanningMusic"}}, &result); err != nil {
+		return false, err
+	}
+	return result["Library.IsScanningMusic"], nil
+}
+
+func (c *Kodi) CreatePlaylist(tracks []*models.Track) error {
+	var playlist strings.Builder
+	playlist.WriteString("#EXTM3U\n")
+	for _, track := range tracks {
+		if !track.Present {
+			continue
+		}
+		fmt.Fprintf(&playlist, "#EXTINF:%d,%s - %s\n%s\n", track.Duration/1000, track.MainArtist, track.CleanTitle, track.LibraryID)
+	}
+
+	path := c.playlistPath()
+	if err := os.WriteFile(path, []byte(playlist.String()), 0666); err != nil {
+		return err
+	}
+	c.Cfg.PlaylistID = path
+	return nil
+}
+
+func (c *Kodi) SearchPlaylist() error {
+	path := c.playlistPath()
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("did not find playlist: %s", c.Cfg.PlaylistName)
+	} else if err != nil {
+		return err
+	}
+	c.Cfg.PlaylistID = path
+	return nil
+}
+
+func (c *Kodi) UpdatePlaylist(description string) error { // M3U playlists have no description
+	return nil
+}
+
+func (c *Kodi) DeletePlaylist() error {
+	if c.Cfg.PlaylistID == "" {
+		return fmt.Errorf("playlist not found")
+	}
+	if err := os.Remove(c.Cfg.PlaylistID); err != nil {
+		return fmt.Errorf("failed to delete playlist: %s", err.Error())
+	}
+	return nil
+}
+
+func (c *Kodi) playlistPath() string {
+	return c.Cfg.PlaylistDir + c.Cfg.PlaylistName + ".m3u"
+}
+
+func (c *Kodi) kodiRequest(method string, params, result any) error {
+	payload, err := json.Marshal(KodiRequest{JSONRPC: "2.0", Method: method, Params: params, ID: 1})
+	if err != nil {
+		return err
+	}
+
+	body, err := c.HttpClient.MakeRequest("POST", c.Cfg.URL+"/jsonrpc", bytes.NewReader(payload), c.Cfg.Creds.Headers)
+	if err != nil {
+		return err
+	}
+
+	var resp KodiResponse
+	if err = util.ParseResp(body, &resp); err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("%s failed: %s", method, resp.Error.Message)
+	}
+	if err = json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("failed to parse %s result: %s", method, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"explo/src/config"
+	"explo/src/debug"
+	"explo/src/models"
+	"explo/src/util"
+)
+
+type LMSRequest struct {
+	ID     int    `json:"id"`
+	Method string `json:"method"`
+	Params []any  `json:"params"` // player ID, and the command with its arguments
+}
+
+type LMSResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  any             `json:"error"`
+}
+
+type LMSTitles struct {
+	Count  int `json:"count"`
+	Titles []struct {
+		ID       json.Number `json:"id"`
+		Title    string      `json:"title"`
+		Artist   string      `json:"artist"`
+		Duration float64     `json:"duration"`
+		URL      string      `json:"url"`
+	} `json:"titles_loop"`
+}
+
+type LMSPlaylists struct {
+	Playlists []struct {
+		ID       json.Number `json:"id"`
+		Playlist string      `json:"playlist"`
+	} `json:"playlists_loop"`
+}
+
+// LMS talks to Lyrion Music Server through slim.request over its JSON-RPC interface
+type LMS struct {
+	HttpClient *util.HttpClient
+	Cfg        *config.ClientConfig
+}
+
+func NewLMS(cfg *config.ClientConfig, httpClient *util.HttpClient) *LMS {
+	return &LMS{Cfg: cfg,
+		HttpClient: httpClient}
+}
+
+func (c *LMS) AddHeader() error { // LMS uses basic auth if password protection is enabled
+	if c.Cfg.Creds.Headers == nil {
+		c.Cfg.Creds.Headers = make(map[string]string)
+	}
+	if c.Cfg.Creds.User != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(c.Cfg.Creds.User + ":" + c.Cfg.Creds.Password))
+		c.Cfg.Creds.Headers["Authorization"] = "Basic " + auth
+	}
+	return nil
+}
+
+func (c *LMS) GetAuth() error {
+	return nil
+}
+
+func (c *LMS) GetLibrary() error { // check that the server is reachable
+	var status map[string]any
+	return c.slimRequest(&status, "serverstatus", 0, 0)
+}
+
+func (c *LMS) AddLibrary() error {
+	return nil
+}
+
+func (c *LMS) SearchSongs(tracks []*models.Track) error {
+	for _, track := range tracks {
+		var result LMSTitles
+		if err := c.slimRequest(&result, "titles", 0, 50, "search:"+track.CleanTitle, "tags:adu"); err != nil {
+			debug.Debug(fmt.Sprintf("failed to search for '%s': %s", track.Title, err.Error()))
+			continue
+		}
+
+		for _, title := range result.Titles {
+			if strings.EqualFold(title.Title, track.CleanTitle) && strings.Contains(strings.ToLower(title.Artist), strings.ToLower(track.MainArtist)) {
+				track.LibraryID = title.URL // playlists are edited by URL
+				track.Present = true
+				if track.Duration == 0 {
+					track.Duration = int(title.Duration * 1000)
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (c *LMS) GetTopArtists(limit int) ([]string, error) {
+	return nil, fmt.Errorf("LMS doesn't expose play counts over JSON-RPC")
+}
+
+func (c *LMS) RefreshLibrary() error {
+	var result map[string]any
+	return c.slimRequest(&result, "rescan")
+}
+
+func (c *LMS) ScanStatus() (bool, error) {
+	var result struct {
+		Rescan json.Number `json:"_rescan"`
+	}
+	if err := c.slimRequest(&result, "rescan", "?"); err != nil {
+		return false, err
+	}
+	return result.Rescan.String() == "1", nil
+}
+
+func (c *LMS) CreatePlaylist(tracks []*models.Track) error {
+	var created struct {
+		ID          json.Number `json:"playlist_id"`
+		Overwritten json.Number `json:"overwritten_playlist_id"` // a playlist with the same name exists
+	}
+	if err := c.slimRequest(&created, "playlists", "new", "name:"+c.Cfg.PlaylistName); err != nil {
+		return err
+	}
+	if created.ID == "" && created.Overwritten != "" { // LMS keeps the existing tracks, replace the playlist so they aren't added twice
+		c.Cfg.PlaylistID = created.Overwritten.String()
+		if err := c.DeletePlaylist(); err != nil {
+			return fmt.Errorf("failed to replace existing playlist: %s", err.Error())
+		}
+		if err := c.slimRequest(&created, "playlists", "new", "name:"+c.Cfg.PlaylistName); err != nil {
+			return err
+		}
+	}
+	c.Cfg.PlaylistID = created.ID.String()
+	if c.Cfg.PlaylistID == "" {
+		return fmt.Errorf("LMS didn't return a playlist ID")
+	}
+
+	for _, track := range tracks {
+		if !track.Present {
+			continue
+		}
+		var result map[string]any
+		if err := c.slimRequest(&result, "playlists", "edit", "cmd:add", "playlist_id:"+c.Cfg.PlaylistID, "url:"+track.LibraryID); err != nil {
+			return fmt.Errorf("failed to add %s - %s: %s", track.Artist, track.Title, err.Error())
+		}
+	}
+	return nil
+}
+
+func (c *LMS) SearchPlaylist() error {
+	var result LMSPlaylists
+	if err := c.slimRequest(&result, "playlists", 0, 1000, "search:"+c.Cfg.PlaylistName); err != nil {
+		return err
+	}
+
+	for _, playlist := range result.Playlists {
+		if playlist.Playlist == c.Cfg.PlaylistName {
+			c.Cfg.PlaylistID = playlist.ID.String()
+			return nil
+		}
+	}
+	return nil
+}
+
+func (c *LMS) UpdatePlaylist(description string) error { // saved playlists have no description
+	return nil
+}
+
+func (c *LMS) DeletePlaylist() error {
+	var result map[string]any
+	return c.slimRequest(&result, "playlists", "delete", "playlist_id:"+c.Cfg.PlaylistID)
+}
+
+func (c *LMS) slimRequest(result any, command ...any) error {
+	payload, err := json.Marshal(LMSRequest{ID: 1, Method: "slim.request", Params: []any{"", command}})
+	if err != nil {
+		return err
+	}
+
+	body, err := c.HttpClient.MakeRequest("POST", c.Cfg.URL+"/jsonrpc.js", bytes.NewReader(payload), c.Cfg.Creds.Headers)
+	if err != nil {
+		return err
+	}
+
+	var resp LMSResponse
+	if err = util.ParseResp(body, &resp); err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("%v failed: %v", command[0], resp.Error)
+	}
+	if len(resp.Result) == 0 || string(resp.Result) == "null" { // commands without output
+		return nil
+	}
+	if err = json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("failed to parse %v result: %s", command[0], err.Error())
+	}
+	return nil
+}
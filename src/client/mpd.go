@@ -12,10 +12,10 @@ import (
 )
 
 type MPD struct {
-	Cfg config.ClientConfig
+	Cfg *config.ClientConfig
 }
 
-func NewMPD(cfg config.ClientConfig) *MPD {
+func NewMPD(cfg *config.ClientConfig) *MPD {
 	return &MPD{Cfg: cfg}
 }
 
@@ -55,10 +55,18 @@ func (c *MPD) SearchSongs(tracks []*models.Track) error {
 	return nil
 }
 
+func (c *MPD) GetTopArtists(limit int) ([]string, error) {
+	return nil, fmt.Errorf("MPD doesn't keep play statistics")
+}
+
 func (c *MPD) RefreshLibrary() error {
 	return nil
 }
 
+func (c *MPD) ScanStatus() (bool, error) { // tracks are looked up on disk, there's no scan to wait for
+	return false, nil
+}
+
 func (c *MPD) CreatePlaylist(tracks []*models.Track) error {
 	f, err := os.OpenFile(c.Cfg.PlaylistDir+c.Cfg.PlaylistName+".m3u", os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0666)
 	if err != nil {
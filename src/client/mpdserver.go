@@ -0,0 +1,339 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"explo/src/config"
+	"explo/src/debug"
+	"explo/src/models"
+)
+
+// MPDServer talks to MPD over its protocol, used instead of MPD's M3U files when MPD_ADDRESS is set
+type MPDServer struct {
+	Cfg *config.ClientConfig
+}
+
+type mpdConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+type mpdSong struct {
+	File     string
+	Artist   string
+	Title    string
+	Duration float64
+}
+
+func NewMPDServer(cfg *config.ClientConfig) *MPDServer {
+	return &MPDServer{Cfg: cfg}
+}
+
+func (c *MPDServer) GetLibrary() error { // check that MPD is reachable and the password is accepted
+	return c.session(func(conn *mpdConn) error {
+		_, err := conn.command("ping")
+		return err
+	})
+}
+
+func (c *MPDServer) GetAuth() error {
+	return nil
+}
+
+func (c *MPDServer) AddHeader() error {
+	return nil
+}
+
+func (c *MPDServer) AddLibrary() error {
+	return nil
+}
+
+func (c *MPDServer) SearchSongs(tracks []*models.Track) error {
+	return c.session(func(conn *mpdConn) error {
+		for _, track := range tracks {
+			song, err := conn.findSong(track)
+			if err != nil {
+				return err
+			}
+			if song.File == "" {
+				debug.Debug(fmt.Sprintf("[mpd] %s - %s not found", track.MainArtist, track.CleanTitle))
+				continue
+			}
+			track.LibraryID = song.File
+			track.Present = true
+			if track.Duration == 0 {
+				track.Duration = int(song.Duration * 1000)
+			}
+		}
+		return nil
+	})
+}
+
+func (c *MPDServer) GetTopArtists(limit int) ([]string, error) {
+	return nil, fmt.Errorf("MPD doesn't keep play statistics")
+}
+
+func (c *MPDServer) RefreshLibrary() error { // update SYSTEM_DOWNLOAD_DIR (relative to MPD's music directory), or the whole database
+	return c.session(func(conn *mpdConn) error {
+		args := []string{}
+		if dir := strings.Trim(c.Cfg.SystemDownloadDir, "/"); dir != "" {
+			args = append(args, dir)
+		}
+		_, err := conn.command("update", args...)
+		return err
+	})
+}
+
+func (c *MPDServer) RefreshPaths(paths []string) error { // update the folders tracks were downloaded to, paths have to be relative to MPD's music directory
+	return c.session(func(conn *mpdConn) error {
+		updated := make(map[string]bool)
+		for _, path := range paths {
+			if filepath.IsAbs(path) {
+				return fmt.Errorf("%s isn't relative to MPD's music directory, set SYSTEM_DOWNLOAD_DIR", path)
+			}
+			dir := filepath.Dir(path)
+			if updated[dir] {
+				continue
+			}
+			updated[dir] = true
+			if _, err := conn.command("update", dir); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (c *MPDServer) ScanStatus() (bool, error) { // wait on 'idle database' for up to SCAN_INTERVAL while MPD is updating
+	var updating bool
+	err := c.session(func(conn *mpdConn) error {
+		status, err := conn.command("status")
+		if err != nil {
+			return err
+		}
+		if _, updating = status["updating_db"]; !updating {
+			return nil
+		}
+
+		if err := conn.conn.SetDeadline(time.Now().Add(time.Duration(c.Cfg.ScanInterval) * time.Second)); err != nil {
+			return err
+		}
+		if _, err := conn.command("idle", "database"); err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() { // still updating
+				return nil
+			}
+			return err
+		}
+		if err := conn.conn.SetDeadline(time.Time{}); err != nil {
+			return err
+		}
+
+		status, err = conn.command("status")
+		if err != nil {
+			return err
+		}
+		_, updating = status["updating_db"]
+		return nil
+	})
+	return updating, err
+}
+
+func (c *MPDServer) CreatePlaylist(tracks []*models.Track) error {
+	return c.session(func(conn *mpdConn) error {
+		// a stored playlist of the same name is replaced, not appended to
+		if _, err := conn.command("playlistclear", c.Cfg.PlaylistName); err != nil && !strings.Contains(err.Error(), "No such playlist") {
+			return fmt.Errorf("failed to clear %s: %s", c.Cfg.PlaylistName, err.Error())
+		}
+		for _, track := range tracks {
+			if !track.Present {
+				continue
+			}
+			if _, err := conn.command("playlistadd", c.Cfg.PlaylistName, track.LibraryID); err != nil {
+				return fmt.Errorf("failed to add %s: %s", track.LibraryID, err.Error())
+			}
+		}
+		c.Cfg.PlaylistID = c.Cfg.PlaylistName
+		return nil
+	})
+}
+
+func (c *MPDServer) SearchPlaylist() error {
+	return c.session(func(conn *mpdConn) error {
+		playlists, err := conn.list("listplaylists")
+		if err != nil {
+			return err
+		}
+		for _, playlist := range playlists["playlist"] {
+			if playlist == c.Cfg.PlaylistName {
+				c.Cfg.PlaylistID = playlist
+				return nil
+			}
+		}
+		return fmt.Errorf("did not find playlist: %s", c.Cfg.PlaylistName)
+	})
+}
+
+func (c *MPDServer) UpdatePlaylist(description string) error { // MPD playlists have no description
+	return nil
+}
+
+func (c *MPDServer) DeletePlaylist() error {
+	if c.Cfg.PlaylistID == "" {
+		return fmt.Errorf("playlist not found")
+	}
+	return c.session(func(conn *mpdConn) error {
+		_, err := conn.command("rm", c.Cfg.PlaylistID)
+		return err
+	})
+}
+
+func (c *MPDServer) session(fn func(*mpdConn) error) error { // MPD closes idle connections, so every call connects again
+	network := "tcp"
+	if strings.HasPrefix(c.Cfg.MPD.Address, "/") || strings.HasPrefix(c.Cfg.MPD.Address, "@") {
+		network = "unix"
+	}
+
+	conn, err := net.DialTimeout(network, c.Cfg.MPD.Address, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to connect to MPD: %s", err.Error())
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			debug.Debug(fmt.Sprintf("failed to close MPD connection: %s", err.Error()))
+		}
+	}()
+
+	mpd := &mpdConn{conn: conn, reader: bufio.NewReader(conn)}
+	greeting, err := mpd.reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read MPD greeting: %s", err.Error())
+	}
+	if !strings.HasPrefix(greeting, "OK MPD ") {
+		return fmt.Errorf("%s doesn't look like MPD: %s", c.Cfg.MPD.Address, strings.TrimSpace(greeting))
+	}
+
+	if c.Cfg.MPD.Password != "" {
+		if _, err := mpd.command("password", c.Cfg.MPD.Password); err != nil {
+			return err
+		}
+	}
+	return fn(mpd)
+}
+
+func (m *mpdConn) findSong(track *models.Track) (mpdSong, error) { // MusicBrainz ID first, then exact and case-insensitive tags
+	var queries [][]string
+	if track.RecordingMBID != "" {
+		queries = append(queries, []string{"find", "MUSICBRAINZ_TRACKID", track.RecordingMBID})
+	}
+	queries = append(queries,
+		[]string{"find", "artist", track.MainArtist, "title", track.CleanTitle},
+		[]string{"search", "artist", track.MainArtist, "title", track.CleanTitle},
+	)
+
+	for _, query := range queries {
+		songs, err := m.songs(query[0], query[1:]...)
+		if err != nil {
+			return mpdSong{}, err
+		}
+		if len(songs) > 0 {
+			return songs[0], nil
+		}
+	}
+	return mpdSong{}, nil
+}
+
+func (m *mpdConn) songs(cmd string, args ...string) ([]mpdSong, error) {
+	lines, err := m.lines(cmd, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var songs []mpdSong
+	for _, line := range lines {
+		key, value, _ := strings.Cut(line, ": ")
+		if key == "file" {
+			songs = append(songs, mpdSong{File: value})
+			continue
+		}
+		if len(songs) == 0 {
+			continue
+		}
+		song := &songs[len(songs)-1]
+		switch key {
+		case "Artist":
+			song.Artist = value
+		case "Title":
+			song.Title = value
+		case "duration":
+			song.Duration, _ = strconv.ParseFloat(value, 64)
+		}
+	}
+	return songs, nil
+}
+
+func (m *mpdConn) command(cmd string, args ...string) (map[string]string, error) { // response as key/value pairs, the last value wins
+	lines, err := m.lines(cmd, args...)
+	if err != nil {
+		return nil, err
+	}
+	pairs := make(map[string]string, len(lines))
+	for _, line := range lines {
+		key, value, _ := strings.Cut(line, ": ")
+		pairs[key] = value
+	}
+	return pairs, nil
+}
+
+func (m *mpdConn) list(cmd string, args ...string) (map[string][]string, error) { // response with repeated keys
+	lines, err := m.lines(cmd, args...)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string][]string)
+	for _, line := range lines {
+		key, value, _ := strings.Cut(line, ": ")
+		values[key] = append(values[key], value)
+	}
+	return values, nil
+}
+
+func (m *mpdConn) lines(cmd string, args ...string) ([]string, error) { // send a command and read its response until OK or ACK
+	var request strings.Builder
+	request.WriteString(cmd)
+	for _, arg := range args {
+		request.WriteString(" " + quoteMPD(arg))
+	}
+	request.WriteString("\n")
+	if _, err := m.conn.Write([]byte(request.String())); err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for {
+		line, err := m.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "OK":
+			return lines, nil
+		case strings.HasPrefix(line, "ACK "):
+			return nil, fmt.Errorf("MPD %s failed: %s", cmd, strings.TrimPrefix(line, "ACK "))
+		}
+		lines = append(lines, line)
+	}
+}
+
+func quoteMPD(arg string) string {
+	arg = strings.ReplaceAll(arg, `\`, `\\`)
+	return `"` + strings.ReplaceAll(arg, `"`, `\"`) + `"`
+}
@@ -0,0 +1,268 @@
+package client
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"explo/src/config"
+	"explo/src/models"
+)
+
+// fakeMPD answers MPD protocol commands with respond, a command it doesn't answer (ok is false) stays pending
+type fakeMPD struct {
+	greeting string
+	respond  func(command string) (response string, ok bool)
+
+	mu       sync.Mutex
+	commands []string
+}
+
+func startFakeMPD(t *testing.T, mpd *fakeMPD) *MPDServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err.Error())
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	if mpd.greeting == "" {
+		mpd.greeting = "OK MPD 0.23.5"
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go mpd.serve(conn)
+		}
+	}()
+
+	cfg := &config.ClientConfig{ScanInterval: 1}
+	cfg.MPD.Address = listener.Addr().String()
+	return NewMPDServer(cfg)
+}
+
+func (m *fakeMPD) serve(conn net.Conn) {
+	defer conn.Close()
+	if _, err := conn.Write([]byte(m.greeting + "\n")); err != nil {
+		return
+	}
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		m.mu.Lock()
+		m.commands = append(m.commands, scanner.Text())
+		m.mu.Unlock()
+
+		if response, ok := m.respond(scanner.Text()); ok {
+			if _, err := conn.Write([]byte(response)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (m *fakeMPD) sent() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.commands
+}
+
+func TestQuoteMPD(t *testing.T) {
+	tests := map[string]string{
+		"Portishead":             `"Portishead"`,
+		`Say "Hello"`:            `"Say \"Hello\""`,
+		`AC\DC`:                  `"AC\\DC"`,
+		`\"`:                     `"\\\""`,
+		"Sigur Rós – Hoppípolla": `"Sigur Rós – Hoppípolla"`,
+	}
+	for arg, want := range tests {
+		if got := quoteMPD(arg); got != want {
+			t.Errorf("quoteMPD(%q) = %s, want %s", arg, got, want)
+		}
+	}
+}
+
+func TestFindSong(t *testing.T) { // MusicBrainz ID first, then exact and case-insensitive tags
+	const (
+		byMBID   = `find "MUSICBRAINZ_TRACKID" "8f3471b5-7e6a-48da-86a9-c1c07a0f47ae"`
+		byTags   = `find "artist" "Massive Attack" "title" "Teardrop"`
+		bySearch = `search "artist" "Massive Attack" "title" "Teardrop"`
+		song     = "file: explo/teardrop.mp3\nArtist: Massive Attack\nTitle: Teardrop\nduration: 330.5\nOK\n"
+	)
+
+	tests := []struct {
+		name     string
+		mbid     string
+		found    string // query that returns the song
+		want     []string
+		wantFile string
+	}{
+		{name: "mbid", mbid: "8f3471b5-7e6a-48da-86a9-c1c07a0f47ae", found: byMBID, want: []string{byMBID}, wantFile: "explo/teardrop.mp3"},
+		{name: "exact tags", mbid: "8f3471b5-7e6a-48da-86a9-c1c07a0f47ae", found: byTags, want: []string{byMBID, byTags}, wantFile: "explo/teardrop.mp3"},
+		{name: "search without mbid", found: bySearch, want: []string{byTags, bySearch}, wantFile: "explo/teardrop.mp3"},
+		{name: "not found", found: "", want: []string{byTags, bySearch}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mpd := &fakeMPD{respond: func(command string) (string, bool) {
+				if command == test.found {
+					return song, true
+				}
+				return "OK\n", true
+			}}
+			server := startFakeMPD(t, mpd)
+
+			track := &models.Track{RecordingMBID: test.mbid, MainArtist: "Massive Attack", CleanTitle: "Teardrop"}
+			if err := server.SearchSongs([]*models.Track{track}); err != nil {
+				t.Fatalf("SearchSongs: %s", err.Error())
+			}
+			if got := mpd.sent(); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("sent %q, want %q", got, test.want)
+			}
+			if track.LibraryID != test.wantFile || track.Present != (test.wantFile != "") {
+				t.Errorf("got LibraryID %q, Present %t, want %q", track.LibraryID, track.Present, test.wantFile)
+			}
+			if test.wantFile != "" && track.Duration != 330500 {
+				t.Errorf("got duration %d, want 330500", track.Duration)
+			}
+		})
+	}
+}
+
+func TestScanStatus(t *testing.T) {
+	const updating = "state: stop\nupdating_db: 1\nOK\n"
+	tests := []struct {
+		name     string
+		statuses []string // responses to 'status'
+		idle     string   // response to 'idle database', empty if the update doesn't finish
+		want     bool
+		wantSent []string
+	}{
+		{name: "not updating", statuses: []string{"state: stop\nOK\n"}, want: false, wantSent: []string{"status"}},
+		{name: "update finishes", statuses: []string{updating, "state: stop\nOK\n"}, idle: "changed: database\nOK\n", want: false, wantSent: []string{"status", `idle "database"`, "status"}},
+		{name: "update continues", statuses: []string{updating, updating}, idle: "changed: database\nOK\n", want: true, wantSent: []string{"status", `idle "database"`, "status"}},
+		{name: "idle times out", statuses: []string{updating}, want: true, wantSent: []string{"status", `idle "database"`}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			statuses := test.statuses
+			mpd := &fakeMPD{respond: func(command string) (string, bool) {
+				switch {
+				case command == "status" && len(statuses) > 0:
+					status := statuses[0]
+					statuses = statuses[1:]
+					return status, true
+				case command == `idle "database"`:
+					return test.idle, test.idle != ""
+				}
+				return "ACK [5@0] {} unknown command\n", true
+			}}
+			server := startFakeMPD(t, mpd)
+
+			updating, err := server.ScanStatus()
+			if err != nil {
+				t.Fatalf("ScanStatus: %s", err.Error())
+			}
+			if updating != test.want {
+				t.Errorf("got updating %t, want %t", updating, test.want)
+			}
+			if got := mpd.sent(); !reflect.DeepEqual(got, test.wantSent) {
+				t.Errorf("sent %q, want %q", got, test.wantSent)
+			}
+		})
+	}
+}
+
+func TestSession(t *testing.T) {
+	tests := []struct {
+		name     string
+		greeting string
+		password string
+		wantErr  string
+		wantSent []string
+	}{
+		{name: "no password", wantSent: []string{"ping"}},
+		{name: "password", password: "secret", wantSent: []string{`password "secret"`, "ping"}},
+		{name: "wrong password", password: "wrong", wantErr: "MPD password failed: [3@0] {password} incorrect password", wantSent: []string{`password "wrong"`}},
+		{name: "not mpd", greeting: "SSH-2.0-OpenSSH_9.6", wantErr: "doesn't look like MPD: SSH-2.0-OpenSSH_9.6"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mpd := &fakeMPD{greeting: test.greeting, respond: func(command string) (string, bool) {
+				if strings.HasPrefix(command, "password") && command != `password "secret"` {
+					return "ACK [3@0] {password} incorrect password\n", true
+				}
+				return "OK\n", true
+			}}
+			server := startFakeMPD(t, mpd)
+			server.Cfg.MPD.Password = test.password
+
+			err := server.GetLibrary()
+			switch {
+			case test.wantErr == "" && err != nil:
+				t.Fatalf("GetLibrary: %s", err.Error())
+			case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+				t.Fatalf("got error %v, want %q", err, test.wantErr)
+			}
+			if got := mpd.sent(); !reflect.DeepEqual(got, test.wantSent) {
+				t.Errorf("sent %q, want %q", got, test.wantSent)
+			}
+		})
+	}
+}
+
+func TestCreatePlaylist(t *testing.T) { // an existing stored playlist is cleared before tracks are added
+	const (
+		clear = `playlistclear "Weekly-Exploration"`
+		add   = `playlistadd "Weekly-Exploration" "explo/teardrop.mp3"`
+	)
+	tests := []struct {
+		name    string
+		cleared string // response to playlistclear
+		wantErr string
+	}{
+		{name: "existing playlist", cleared: "OK\n"},
+		{name: "new playlist", cleared: "ACK [50@0] {playlistclear} No such playlist\n"},
+		{name: "clear fails", cleared: "ACK [4@0] {playlistclear} you don't have permission for \"playlistclear\"\n", wantErr: "failed to clear Weekly-Exploration"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mpd := &fakeMPD{respond: func(command string) (string, bool) {
+				if command == clear {
+					return test.cleared, true
+				}
+				return "OK\n", true
+			}}
+			server := startFakeMPD(t, mpd)
+			server.Cfg.PlaylistName = "Weekly-Exploration"
+
+			err := server.CreatePlaylist([]*models.Track{
+				{LibraryID: "explo/teardrop.mp3", Present: true},
+				{LibraryID: "explo/missing.mp3"},
+			})
+			wantSent := []string{clear, add}
+			switch {
+			case test.wantErr == "" && err != nil:
+				t.Fatalf("CreatePlaylist: %s", err.Error())
+			case test.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want %q", err, test.wantErr)
+				}
+				wantSent = []string{clear}
+			}
+			if got := mpd.sent(); !reflect.DeepEqual(got, wantSent) {
+				t.Errorf("sent %q, want %q", got, wantSent)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"explo/src/config"
+	"explo/src/models"
+	"explo/src/util"
+)
+
+type NDLogin struct {
+	Token   string `json:"token"`
+	ID      string `json:"id"`
+	IsAdmin bool   `json:"isAdmin"`
+}
+
+type NDUser struct {
+	ID       string `json:"id"`
+	UserName string `json:"userName"`
+}
+
+type NDPlaylist struct {
+	ID      string `json:"id,omitempty"`
+	Name    string `json:"name"`
+	Comment string `json:"comment,omitempty"`
+	Public  bool   `json:"public"`
+	OwnerID string `json:"ownerId,omitempty"`
+}
+
+// Navidrome manages playlists through the native API, searching and scanning go through the Subsonic API.
+// Playlists are regular ones, covers are built by Navidrome from the tracks' album art
+type Navidrome struct {
+	*Subsonic
+	AuthToken string
+	UserID    string
+	OwnerID   string // user playlists are created for, NAVIDROME_PLAYLIST_OWNER or the logged in user
+}
+
+func NewNavidrome(cfg *config.ClientConfig, httpClient *util.HttpClient) *Navidrome {
+	return &Navidrome{Subsonic: NewSubsonic(cfg, httpClient)}
+}
+
+func (c *Navidrome) AddHeader() error {
+	if c.AuthToken == "" {
+		return fmt.Errorf("not logged in to Navidrome")
+	}
+	if c.Cfg.Creds.Headers == nil {
+		c.Cfg.Creds.Headers = make(map[string]string)
+	}
+	c.Cfg.Creds.Headers["x-nd-authorization"] = "Bearer " + c.AuthToken
+	return nil
+}
+
+func (c *Navidrome) GetAuth() error { // log in to the native API, and generate the Subsonic salt and token
+	if err := c.Subsonic.GetAuth(); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(map[string]string{
+		"username": c.Cfg.Creds.User,
+		"password": c.Cfg.Creds.Password,
+	})
+	if err != nil {
+		return err
+	}
+
+	body, err := c.HttpClient.MakeRequest("POST", c.Cfg.URL+"/auth/login", bytes.NewReader(payload), nil)
+	if err != nil {
+		return fmt.Errorf("failed to log in: %s", err.Error())
+	}
+
+	var login NDLogin
+	if err = util.ParseResp(body, &login); err != nil {
+		return err
+	}
+	c.AuthToken = login.Token
+	c.UserID = login.ID
+	c.OwnerID = login.ID
+	if err := c.AddHeader(); err != nil {
+		return err
+	}
+
+	if owner := c.Cfg.Navidrome.Owner; owner != "" && owner != c.Cfg.Creds.User {
+		if !login.IsAdmin {
+			return fmt.Errorf("NAVIDROME_PLAYLIST_OWNER requires SYSTEM_USERNAME to be an admin")
+		}
+		if c.OwnerID, err = c.getUserID(owner); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Navidrome) CreatePlaylist(tracks []*models.Track) error {
+	playlist, err := json.Marshal(NDPlaylist{
+		Name:   c.Cfg.PlaylistName,
+		Public: c.Cfg.Navidrome.Public,
+	})
+	if err != nil {
+		return err
+	}
+
+	body, err := c.HttpClient.MakeRequest("POST", c.Cfg.URL+"/api/playlist", bytes.NewReader(playlist), c.Cfg.Creds.Headers)
+	if err != nil {
+		return err
+	}
+
+	var created NDPlaylist
+	if err = util.ParseResp(body, &created); err != nil {
+		return err
+	}
+	c.Cfg.PlaylistID = created.ID
+
+	var ids struct {
+		IDs []string `json:"ids"`
+	}
+	for _, track := range tracks {
+		if !track.Present {
+			continue
+		}
+		ids.IDs = append(ids.IDs, track.LibraryID)
+	}
+	payload, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+
+	reqParam := fmt.Sprintf("/api/playlist/%s/tracks", c.Cfg.PlaylistID)
+	if _, err := c.HttpClient.MakeRequest("POST", c.Cfg.URL+reqParam, bytes.NewReader(payload), c.Cfg.Creds.Headers); err != nil {
+		return fmt.Errorf("failed to add tracks: %s", err.Error())
+	}
+	return nil
+}
+
+func (c *Navidrome) SearchPlaylist() error {
+	body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+"/api/playlist", nil, c.Cfg.Creds.Headers)
+	if err != nil {
+		return err
+	}
+
+	var playlists []NDPlaylist
+	if err = util.ParseResp(body, &playlists); err != nil {
+		return err
+	}
+
+	for _, playlist := range playlists {
+		if playlist.Name == c.Cfg.PlaylistName && playlist.OwnerID == c.OwnerID {
+			c.Cfg.PlaylistID = playlist.ID
+			return nil
+		}
+	}
+	return nil
+}
+
+func (c *Navidrome) UpdatePlaylist(comment string) error { // set comment, public flag and owner
+	payload, err := json.Marshal(NDPlaylist{
+		ID:      c.Cfg.PlaylistID,
+		Name:    c.Cfg.PlaylistName,
+		Comment: comment,
+		Public:  c.Cfg.Navidrome.Public,
+		OwnerID: c.OwnerID,
+	})
+	if err != nil {
+		return err
+	}
+
+	reqParam := fmt.Sprintf("/api/playlist/%s", c.Cfg.PlaylistID)
+	if _, err := c.HttpClient.MakeRequest("PUT", c.Cfg.URL+reqParam, bytes.NewReader(payload), c.Cfg.Creds.Headers); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Navidrome) DeletePlaylist() error {
+	reqParam := fmt.Sprintf("/api/playlist/%s", c.Cfg.PlaylistID)
+
+	if _, err := c.HttpClient.MakeRequest("DELETE", c.Cfg.URL+reqParam, nil, c.Cfg.Creds.Headers); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Navidrome) getUserID(name string) (string, error) {
+	body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+"/api/user", nil, c.Cfg.Creds.Headers)
+	if err != nil {
+		return "", fmt.Errorf("failed to get users: %s", err.Error())
+	}
+
+	var users []NDUser
+	if err = util.ParseResp(body, &users); err != nil {
+		return "", err
+	}
+	for _, user := range users {
+		if user.UserName == name {
+			return user.ID, nil
+		}
+	}
+	return "", fmt.Errorf("failed to find user named %s", name)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"net/url"
+	"path/filepath"
 	"strings"
 
 	"explo/src/config"
@@ -37,6 +38,7 @@ type Libraries struct {
 		Library []struct {
 			Title 			 string `json:"title"`
 			Key              string `json:"key"`
+			Refreshing       bool   `json:"refreshing"`
 			Location         []struct {
 				ID   int    `json:"id"`
 				Path string `json:"path"`
@@ -62,6 +64,9 @@ type PlexSearch struct {
 				Duration             int    `json:"duration"`
 				AddedAt              int    `json:"addedAt"`
 				UpdatedAt            int    `json:"updatedAt"`
+				Guid                 []struct {
+					ID string `json:"id"`
+				} `json:"Guid"`
 				Media                []struct {
 					ID            int    `json:"id"`
 					Duration      int    `json:"duration"`
@@ -82,6 +87,30 @@ type PlexSearch struct {
 }
 
 	
+type PlexArtists struct {
+	MediaContainer struct {
+		Size     int `json:"size"`
+		Metadata []struct {
+			Title     string `json:"title"`
+			ViewCount int    `json:"viewCount"`
+		} `json:"Metadata"`
+	} `json:"MediaContainer"`
+}
+
+type PlexTracks struct {
+	MediaContainer struct {
+		Metadata []struct {
+			UserRating float64 `json:"userRating"` // out of 10
+			ViewCount  int     `json:"viewCount"`
+			Media      []struct {
+				Part []struct {
+					File string `json:"file"`
+				} `json:"Part"`
+			} `json:"Media"`
+		} `json:"Metadata"`
+	} `json:"MediaContainer"`
+}
+
 type PlexServer struct {
 	MediaContainer struct {
 		Size              int    `json:"size"`
@@ -115,10 +144,11 @@ type Plex struct {
 	machineID string
 	LibraryID string
 	HttpClient *util.HttpClient
-	Cfg config.ClientConfig
+	Cfg *config.ClientConfig
+	DryRun bool // report a missing library instead of adding it
 }
 
-func NewPlex(cfg config.ClientConfig, httpClient *util.HttpClient) *Plex {
+func NewPlex(cfg *config.ClientConfig, httpClient *util.HttpClient) *Plex {
 	return &Plex{
 		Cfg: cfg,
 		HttpClient: httpClient}
@@ -192,6 +222,10 @@ func (c *Plex) GetLibrary() error {
 			return nil
 		}
 	}
+	if c.DryRun {
+		log.Printf("[plex] library named %s not found, it would be added", c.Cfg.LibraryName)
+		return nil
+	}
 	if err = c.AddLibrary(); err != nil {
 		debug.Debug(err.Error())
 		log.Fatalf("library named %s not found and cannot be added, please create it manually and ensure 'Prefer local metadata' is checked", c.Cfg.LibraryName)
@@ -224,9 +258,44 @@ func (c *Plex) RefreshLibrary() error {
 	return nil
 }
 
+func (c *Plex) RefreshPaths(paths []string) error { // partial scan of the folders tracks were downloaded to
+	scanned := make(map[string]bool)
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		if scanned[dir] {
+			continue
+		}
+		scanned[dir] = true
+
+		params := fmt.Sprintf("/library/sections/%s/refresh?path=%s", c.LibraryID, url.QueryEscape(dir))
+		if _, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+params, nil, c.Cfg.Creds.Headers); err != nil {
+			return fmt.Errorf("failed to scan %s: %s", dir, err.Error())
+		}
+	}
+	return nil
+}
+
+func (c *Plex) ScanStatus() (bool, error) { // true while the library section is refreshing
+	body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+"/library/sections/", nil, c.Cfg.Creds.Headers)
+	if err != nil {
+		return false, err
+	}
+
+	var libraries Libraries
+	if err = util.ParseResp(body, &libraries); err != nil {
+		return false, err
+	}
+	for _, library := range libraries.MediaContainer.Library {
+		if library.Key == c.LibraryID {
+			return library.Refreshing, nil
+		}
+	}
+	return false, fmt.Errorf("library '%s' not found", c.Cfg.LibraryName)
+}
+
 func (c *Plex) SearchSongs(tracks []*models.Track) error {
 	for _, track := range tracks {
-		params := fmt.Sprintf("/library/search?query=%s", url.QueryEscape(track.CleanTitle))
+		params := fmt.Sprintf("/library/search?query=%s&includeGuids=1", url.QueryEscape(track.CleanTitle))
 
 		body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+params, nil, c.Cfg.Creds.Headers)
 		if err != nil {
@@ -245,13 +314,63 @@ func (c *Plex) SearchSongs(tracks []*models.Track) error {
 			continue
 		}
 		if key != "" {
-			track.ID = key
+			track.LibraryID = key
 			track.Present = true
 		}
 	}
 	return nil
 }
 
+func (c *Plex) GetTopArtists(limit int) ([]string, error) {
+	params := fmt.Sprintf("/library/sections/%s/all?type=8&sort=viewCount:desc&X-Plex-Container-Start=0&X-Plex-Container-Size=%d", c.LibraryID, limit)
+
+	body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+params, nil, c.Cfg.Creds.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	var results PlexArtists
+	if err = util.ParseResp(body, &results); err != nil {
+		return nil, err
+	}
+
+	artists := make([]string, 0, len(results.MediaContainer.Metadata))
+	for _, artist := range results.MediaContainer.Metadata {
+		if artist.ViewCount > 0 {
+			artists = append(artists, artist.Title)
+		}
+	}
+	return rankArtists(artists, limit), nil
+}
+
+func (c *Plex) LikedTracks() ([]LikedTrack, error) { // tracks in the Explo library, Plex has ratings but no favourites
+	params := fmt.Sprintf("/library/sections/%s/all?type=10", c.LibraryID)
+
+	body, err := c.HttpClient.MakeRequest("GET", c.Cfg.URL+params, nil, c.Cfg.Creds.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	var results PlexTracks
+	if err = util.ParseResp(body, &results); err != nil {
+		return nil, err
+	}
+
+	var tracks []LikedTrack
+	for _, track := range results.MediaContainer.Metadata {
+		for _, media := range track.Media {
+			for _, part := range media.Part {
+				tracks = append(tracks, LikedTrack{
+					Path:   part.File,
+					Rating: int(track.UserRating / 2),
+					Plays:  track.ViewCount,
+				})
+			}
+		}
+	}
+	return tracks, nil
+}
+
 func (c *Plex) SearchPlaylist() error {
 	params := "/playlists"
 
@@ -340,6 +459,12 @@ func getPlexSong(track *models.Track, searchResults PlexSearch) (string, error)
 			continue
 		}
 
+		for _, guid := range md.Guid {
+			if track.RecordingMBID != "" && strings.EqualFold(guid.ID, "mbid://"+track.RecordingMBID) {
+				return md.Key, nil
+			}
+		}
+
 		titleMatch := strings.EqualFold(md.Title, track.Title) || strings.EqualFold(md.Title, track.CleanTitle)
 		albumMatch := strings.EqualFold(md.ParentTitle, track.Album)
 		artistMatch := strings.Contains(strings.ToLower(md.OriginalTitle), loweredArtist) || strings.Contains(strings.ToLower(md.GrandparentTitle), loweredArtist)
@@ -368,8 +493,8 @@ func getPlexSong(track *models.Track, searchResults PlexSearch) (string, error)
 func (c *Plex) addtoPlaylist(tracks []*models.Track) {
 
 	for _, track := range tracks {
-		if track.ID != "" {
-			params := fmt.Sprintf("/playlists/%s/items?uri=server://%s/com.plexapp.plugins.library%s", c.Cfg.PlaylistID, c.machineID, track.ID)
+		if track.LibraryID != "" {
+			params := fmt.Sprintf("/playlists/%s/items?uri=server://%s/com.plexapp.plugins.library%s", c.Cfg.PlaylistID, c.machineID, track.LibraryID)
 
 			if _, err := c.HttpClient.MakeRequest("PUT", c.Cfg.URL+params, nil, c.Cfg.Creds.Headers); err != nil {
 				log.Printf("failed to add %s to playlist: %s", track.Title, err.Error())
@@ -2,12 +2,15 @@ package client
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
 	"crypto/md5"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/json"
+	"log"
 	"net/url"
 
 	"explo/src/config"
@@ -33,14 +36,29 @@ type SubResponse struct {
 		Type          string        `json:"type"`
 		ServerVersion string        `json:"serverVersion"`
 		SearchResult3 struct {
-			Song []struct {
-				ID          string    `json:"id"`
-				Title       string    `json:"title"`
-				Artist        string    `json:"artist"`
-				Duration      int       `json:"duration"`
-				Path          string    `json:"path"`
-			} `json:"song"`
+			Song []SubSong `json:"song"`
 		} `json:"searchResult3,omitempty"`
+		Starred2 struct {
+			Song []SubSong `json:"song"`
+		} `json:"starred2,omitempty"`
+		AlbumList2 struct {
+			Album []struct {
+				ID        string `json:"id"`
+				Name      string `json:"name"`
+				Artist    string `json:"artist"`
+				PlayCount int    `json:"playCount"`
+			} `json:"album"`
+		} `json:"albumList2,omitempty"`
+		MusicFolders struct {
+			MusicFolder []struct {
+				ID   json.Number `json:"id"`
+				Name string      `json:"name"`
+			} `json:"musicFolder"`
+		} `json:"musicFolders,omitempty"`
+		ScanStatus    struct {
+			Scanning bool `json:"scanning"`
+			Count    int  `json:"count"`
+		} `json:"scanStatus,omitempty"`
 		Playlists     struct {
 			Playlist []Playlist `json:"playlist,omitempty"`
 		} `json:"playlists,omitempty"`
@@ -48,6 +66,18 @@ type SubResponse struct {
 	} `json:"subsonic-response"`
 }
 
+type SubSong struct {
+	ID            string `json:"id"`
+	Title         string `json:"title"`
+	Artist        string `json:"artist"`
+	Duration      int    `json:"duration"`
+	Path          string `json:"path"`
+	MusicBrainzID string `json:"musicBrainzId"` // OpenSubsonic
+	Starred       string `json:"starred"`       // time the song was starred, empty if it isn't
+	UserRating    int    `json:"userRating"`
+	PlayCount     int    `json:"playCount"`
+}
+
 type Playlist struct {
 	ID        string    `json:"id"`
 	Name      string    `json:"name"`
@@ -65,10 +95,10 @@ type Subsonic struct {
 	Token string
 	Salt string
 	HttpClient *util.HttpClient
-	Cfg config.ClientConfig
+	Cfg *config.ClientConfig
 }
 
-func NewSubsonic(cfg config.ClientConfig, httpClient *util.HttpClient) *Subsonic {
+func NewSubsonic(cfg *config.ClientConfig, httpClient *util.HttpClient) *Subsonic {
 	return &Subsonic{Cfg: cfg,
 		HttpClient: httpClient}
 }
@@ -126,25 +156,31 @@ func (c *Subsonic) SearchSongs(tracks []*models.Track) error {
 		}
 
 		if len(songs) == 1 {
-			track.ID = songs[0].ID
+			track.LibraryID = songs[0].ID
 			track.Present = true
 			continue
 		}
 
 		for _, song := range songs {
+			if track.RecordingMBID != "" && strings.EqualFold(song.MusicBrainzID, track.RecordingMBID) {
+				track.LibraryID = song.ID
+				track.Present = true
+				break
+			}
+
 			artistMatch := strings.Contains(strings.ToLower(song.Artist), strings.ToLower(track.MainArtist))
 			titleMatch := strings.EqualFold(song.Title, track.Title) || strings.EqualFold(song.Title, track.CleanTitle)
 			durationMatch := util.Abs(song.Duration - (track.Duration / 1000)) < 10
 			pathMatch := strings.Contains(strings.ToLower(song.Path), strings.ToLower(track.File))
 
 			if artistMatch && titleMatch {
-				track.ID = song.ID
+				track.LibraryID = song.ID
 				track.Present = true
 				break
 			}
 
 			if track.File != "" && durationMatch && pathMatch {
-				track.ID = song.ID
+				track.LibraryID = song.ID
 				track.Present = true
 				break
 			}
@@ -157,6 +193,26 @@ func (c *Subsonic) SearchSongs(tracks []*models.Track) error {
 	return nil
 }
 
+func (c *Subsonic) GetTopArtists(limit int) ([]string, error) {
+	reqParam := "getAlbumList2?type=frequent&size=500&f=json"
+
+	body, err := c.subsonicRequest(reqParam)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp SubResponse
+	if err := util.ParseResp(body, &resp); err != nil {
+		return nil, err
+	}
+
+	artists := make([]string, 0, len(resp.SubsonicResponse.AlbumList2.Album))
+	for _, album := range resp.SubsonicResponse.AlbumList2.Album {
+		artists = append(artists, album.Artist)
+	}
+	return rankArtists(artists, limit), nil
+}
+
 func (c *Subsonic) RefreshLibrary() error {
 	reqParam := "startScan?f=json"
 	
@@ -166,10 +222,95 @@ func (c *Subsonic) RefreshLibrary() error {
 	return nil
 }
 
+func (c *Subsonic) ScanStatus() (bool, error) {
+	body, err := c.subsonicRequest("getScanStatus?f=json")
+	if err != nil {
+		return false, err
+	}
+
+	var resp SubResponse
+	if err = util.ParseResp(body, &resp); err != nil {
+		return false, err
+	}
+	return resp.SubsonicResponse.ScanStatus.Scanning, nil
+}
+
+func (c *Subsonic) LikedTracks() ([]LikedTrack, error) { // starred songs, and rated or played songs in the LIBRARY_NAME music folder if those are kept
+	folder, err := c.musicFolder()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.subsonicRequest("getStarred2?f=json" + folder)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp SubResponse
+	if err := util.ParseResp(body, &resp); err != nil {
+		return nil, err
+	}
+	songs := resp.SubsonicResponse.Starred2.Song
+
+	if slices.Contains(c.Cfg.Keep, "rating") || slices.Contains(c.Cfg.Keep, "played") {
+		if folder == "" { // there's no filter for those, listing every song of a large library takes hundreds of requests
+			log.Printf("[subsonic] music folder '%s' not found, only starred tracks are kept. Set LIBRARY_NAME to the folder with DOWNLOAD_DIR to keep rated or played ones", c.Cfg.LibraryName)
+		}
+		for offset := 0; folder != ""; offset += 500 { // an empty search lists every song (Navidrome and most servers)
+			reqParam := fmt.Sprintf("search3?query=&artistCount=0&albumCount=0&songCount=500&songOffset=%d&f=json%s", offset, folder)
+			body, err := c.subsonicRequest(reqParam)
+			if err != nil {
+				return nil, err
+			}
+
+			var page SubResponse
+			if err := util.ParseResp(body, &page); err != nil {
+				return nil, err
+			}
+			songs = append(songs, page.SubsonicResponse.SearchResult3.Song...)
+			if len(page.SubsonicResponse.SearchResult3.Song) < 500 {
+				break
+			}
+		}
+	}
+
+	tracks := make([]LikedTrack, 0, len(songs))
+	for _, song := range songs {
+		tracks = append(tracks, LikedTrack{
+			Path:     song.Path,
+			Favorite: song.Starred != "",
+			Rating:   song.UserRating,
+			Plays:    song.PlayCount,
+		})
+	}
+	return tracks, nil
+}
+
+func (c *Subsonic) musicFolder() (string, error) { // musicFolderId parameter of the LIBRARY_NAME folder, empty if there's none
+	if c.Cfg.LibraryName == "" {
+		return "", nil
+	}
+	body, err := c.subsonicRequest("getMusicFolders?f=json")
+	if err != nil {
+		return "", err
+	}
+
+	var resp SubResponse
+	if err := util.ParseResp(body, &resp); err != nil {
+		return "", err
+	}
+	for _, folder := range resp.SubsonicResponse.MusicFolders.MusicFolder {
+		if folder.Name == c.Cfg.LibraryName {
+			return "&musicFolderId=" + folder.ID.String(), nil
+		}
+	}
+	return "", nil
+}
+
 func (c *Subsonic) CreatePlaylist(tracks []*models.Track) error {
 	var trackIDs strings.Builder
 	for _, track := range tracks { // build songID parameters
-		fmt.Fprintf(&trackIDs, "&songId=%s", track.ID)
+		fmt.Fprintf(&trackIDs, "&songId=%s", track.LibraryID)
 	}
 
 	reqParam := fmt.Sprintf("createPlaylist?name=%s%s&f=json", c.Cfg.PlaylistName, trackIDs.String())
@@ -4,7 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
+	"reflect"
+	"slices"
+	"strconv"
 	"time"
 	"strings"
 	"github.com/ilyakaznacheev/cleanenv"
@@ -14,9 +18,26 @@ type Config struct {
 	DownloadCfg DownloadConfig
 	DiscoveryCfg DiscoveryConfig
 	ClientCfg ClientConfig
+	ServerCfg ServerConfig
 	Persist bool `env:"PERSIST" env-default:"true"`
-	System string `env:"EXPLO_SYSTEM"`
+	RetentionWeeks int `env:"RETENTION_WEEKS" env-default:"0"` // Remove playlists and downloads of runs older than this with PERSIST=true, 0 keeps them forever
+	RetentionDays int `env:"RETENTION_DAYS" env-default:"0"` // Same as RETENTION_WEEKS in days
+	System string `env:"EXPLO_SYSTEM"` // Comma-separated list of music systems, see ForSystem for per-system settings
+	Users string `env:"EXPLO_USERS"` // Comma-separated 'listenbrainz_user:system_user' pairs, see ForUsers for per-user settings
+	User string // System user of a config returned by ForUsers
 	Debug bool `env:"DEBUG" env-default:"false"`
+	DryRun bool `env:"DRY_RUN" env-default:"false"` // Report what a run would do, without downloading or changing playlists
+	StateFile string `env:"STATE_FILE" env-default:"explo.db"` // Database of runs and track outcomes
+	Schedule string `env:"SCHEDULE"` // Cron expression, keeps Explo running and explores on schedule
+	RunOnStart bool `env:"RUN_ON_START" env-default:"false"` // Explore once when started with a schedule
+	YtdlpUpdate string `env:"YTDLP_UPDATE"` // Shell command run before each run of the daemon, keeps a long-running yt-dlp up to date
+}
+
+type ServerConfig struct {
+	Address string `env:"HTTP_ADDR"` // Address the HTTP API listens on (e.g. :8080), disabled if empty
+	Token string `env:"HTTP_TOKEN"` // Bearer token required by the HTTP API
+	Review bool `env:"REVIEW" env-default:"false"` // Wait for tracks to be reviewed in the dashboard before creating playlists
+	ReviewTimeout int `env:"REVIEW_TIMEOUT" env-default:"24"` // Hours to wait for a review before publishing anyway, 0 waits forever
 }
 
 type ClientConfig struct {
@@ -24,12 +45,21 @@ type ClientConfig struct {
 	LibraryName string `env:"LIBRARY_NAME" env-default:"Explo"`
 	URL string `env:"SYSTEM_URL"`
 	DownloadDir string `env:"DOWNLOAD_DIR" env-default:"/data/"`
+	SystemDownloadDir string `env:"SYSTEM_DOWNLOAD_DIR"` // DOWNLOAD_DIR as the music system sees it, if it differs
+	RefreshMode string `env:"REFRESH_MODE" env-default:"full"` // 'full' rescans the library, 'path' only the downloaded files
 	PlaylistDir string `env:"PLAYLIST_DIR"`
 	PlaylistName string
 	PlaylistID string
-	Sleep int `env:"SLEEP" env-default:"2"`
+	Sleep int `env:"SLEEP" env-default:"2"` // Minutes to wait after a library scan if its status can't be read
+	ScanTimeout int `env:"SCAN_TIMEOUT" env-default:"10"` // Minutes to wait for a library scan to finish, 0 always sleeps instead
+	ScanInterval int `env:"SCAN_INTERVAL" env-default:"10"` // Seconds between scan status checks
+	SearchRetries int `env:"SEARCH_RETRIES" env-default:"0"` // Searches for tracks still missing after the scan
+	Keep []string `env:"KEEP_TRACKS" env-default:"favorite,rating"` // Engagement that keeps a download when PERSIST=false: favorite, rating and/or played
+	KeepRating int `env:"KEEP_MIN_RATING" env-default:"4"` // Stars out of 5 a rated track needs to be kept
 	Creds Credentials
 	Subsonic SubsonicConfig
+	Navidrome NavidromeConfig
+	MPD MPDConfig
 }
 
 type Credentials struct {
@@ -42,6 +72,14 @@ type Credentials struct {
 }
 
 
+type MPDConfig struct {
+	Address string `env:"MPD_ADDRESS"` // host:port or socket path, M3U files are written to PLAYLIST_DIR if not set
+	Password string `env:"MPD_PASSWORD"`
+}
+type NavidromeConfig struct {
+	Public bool `env:"NAVIDROME_PUBLIC_PLAYLIST" env-default:"false"` // Share playlists with every user
+	Owner string `env:"NAVIDROME_PLAYLIST_OWNER"` // User to create playlists for, SYSTEM_USERNAME has to be an admin
+}
 type SubsonicConfig struct {
 	Version	string `env:"SUBSONIC_VERSION" env-default:"1.16.1"`
 	ID string `env:"CLIENT" env-default:"explo"`
@@ -52,12 +90,21 @@ type SubsonicConfig struct {
 
 type DownloadConfig struct {
 	DownloadDir string `env:"DOWNLOAD_DIR" env-default:"/data/"`
+	KeepDir string `env:"KEEP_DIR"` // Liked downloads are moved here when PERSIST=false, they stay in DownloadDir if empty
 	Youtube Youtube
 	Slskd Slskd
+	Tagging Tagging
 	Discovery string `env:"LISTENBRAINZ_DISCOVERY" env-default:"playlist"`
 	Services []string `env:"DOWNLOAD_SERVICES" env-default:"youtube"`
 }
 
+type Tagging struct {
+	Enabled bool `env:"TAG_FILES" env-default:"true"` // Write MusicBrainz tags to downloaded files
+	CoverArt bool `env:"EMBED_COVER_ART" env-default:"true"`
+	TrackNumbers bool `env:"TAG_TRACK_NUMBERS" env-default:"true"` // Look up track numbers from MusicBrainz (1 request per second)
+	FfmpegPath string `env:"FFMPEG_PATH"`
+}
+
 type Filters struct {
 	Extensions []string `env:"EXTENSIONS" env-default:"flac,mp3"`
 	MinBitDepth int `env:"MIN_BIT_DEPTH" env-default:"8"`
@@ -84,13 +131,48 @@ type Slskd struct {
 }
 
 type DiscoveryConfig struct {
-	Discovery string `env:"DISCOVERY_SERVICE" env-default:"listenbrainz"`
+	Discovery []string `env:"DISCOVERY_SERVICE" env-default:"listenbrainz"`
+	Weights map[string]int `env:"DISCOVERY_WEIGHTS"` // Tracks taken from each service per round when blending (default: 1)
+	Limit int `env:"DISCOVERY_LIMIT" env-default:"0"` // Max number of tracks after blending (0 means no limit)
 	Listenbrainz Listenbrainz
+	Lastfm Lastfm
+	Files Files
+	Library Library
 }
 type Listenbrainz struct {
 	Discovery string `env:"LISTENBRAINZ_DISCOVERY" env-default:"playlist"`
 	User string `env:"LISTENBRAINZ_USER"`
 	SingleArtist bool `env:"SINGLE_ARTIST" env-default:"true"`
+	Playlists []string `env:"LISTENBRAINZ_PLAYLISTS" env-default:"weekly-exploration"` // Generated playlists to mirror in 'playlist' mode
+	Token string `env:"LISTENBRAINZ_TOKEN"`
+	RadioPrompt string `env:"LISTENBRAINZ_RADIO_PROMPT"` // LB Radio prompt used in 'radio' mode
+	RadioPlaylists string `env:"LISTENBRAINZ_RADIO_PLAYLISTS"` // Themed playlists as 'Name=prompt' pairs separated by ';'
+	RadioMode string `env:"LISTENBRAINZ_RADIO_MODE" env-default:"easy"`
+}
+
+func (cfg Listenbrainz) UsesRadio() bool { // LB Radio needs a token, unlike the other endpoints Explo uses
+	return cfg.Discovery == "radio" || strings.TrimSpace(cfg.RadioPlaylists) != ""
+}
+
+type Library struct {
+	Seeds int `env:"LIBRARY_SEEDS" env-default:"10"` // Number of top artists in the music system to seed recommendations from
+	SimilarArtists int `env:"LIBRARY_SIMILAR_ARTISTS" env-default:"3"` // Similar artists picked per seed artist
+	TracksPerArtist int `env:"LIBRARY_TRACKS_PER_ARTIST" env-default:"2"` // Popular recordings picked per similar artist
+}
+
+type Files struct {
+	Path string `env:"FILE_DISCOVERY_PATH"` // File or directory of JSPF, XSPF, M3U or CSV lists
+	AsPlaylists bool `env:"FILE_DISCOVERY_PLAYLISTS" env-default:"false"` // Create a separate playlist from each file
+}
+
+type Lastfm struct {
+	Discovery string `env:"LASTFM_DISCOVERY" env-default:"artists"` // 'artists' (similar artists) or 'tracks' (similar tracks)
+	User string `env:"LASTFM_USER"`
+	APIKey string `env:"LASTFM_API_KEY"`
+	URL string `env:"LASTFM_URL" env-default:"https://ws.audioscrobbler.com/2.0/"`
+	Period string `env:"LASTFM_PERIOD" env-default:"3month"` // Time period of top artists/tracks used as seeds
+	Seeds int `env:"LASTFM_SEEDS" env-default:"10"` // Number of top artists/tracks to seed recommendations from
+	Limit int `env:"LASTFM_LIMIT" env-default:"50"` // Max number of recommended tracks
 }
 
 func ReadEnv() Config {
@@ -113,12 +195,298 @@ func ReadEnv() Config {
 	return cfg
 }
 
+var (
+	Systems = []string{"ampache", "emby", "funkwhale", "jellyfin", "kodi", "lms", "mpd", "navidrome", "plex", "subsonic"}
+	DiscoveryServices = []string{"listenbrainz", "lastfm", "file", "library"}
+	KeepCriteria = []string{"favorite", "rating", "played"}
+	DownloadServices = []string{"youtube", "slskd"}
+)
+
+func (cfg *Config) Validate() error { // Check settings that would otherwise fail mid-run, the music system is checked when connecting to it
+	var errs []error
+	names := cfg.SystemNames()
+	if len(names) == 0 {
+		errs = append(errs, errors.New("EXPLO_SYSTEM is required"))
+	}
+	for i, name := range names {
+		if !slices.Contains(Systems, name) {
+			errs = append(errs, fmt.Errorf("EXPLO_SYSTEM '%s' is not supported, use one of: %s", name, strings.Join(Systems, ", ")))
+		}
+		if slices.Contains(names[:i], name) {
+			errs = append(errs, fmt.Errorf("EXPLO_SYSTEM lists %s more than once", name))
+		}
+		if _, err := cfg.ForSystem(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, service := range cfg.DiscoveryCfg.Discovery {
+		if !slices.Contains(DiscoveryServices, service) {
+			errs = append(errs, fmt.Errorf("DISCOVERY_SERVICE '%s' is not supported, use one of: %s", service, strings.Join(DiscoveryServices, ", ")))
+		}
+	}
+	if slices.Contains(cfg.DiscoveryCfg.Discovery, "listenbrainz") && cfg.DiscoveryCfg.Listenbrainz.User == "" && cfg.DiscoveryCfg.Listenbrainz.Discovery != "radio" && cfg.Users == "" {
+		errs = append(errs, errors.New("LISTENBRAINZ_USER is required"))
+	}
+	if slices.Contains(cfg.DiscoveryCfg.Discovery, "lastfm") && (cfg.DiscoveryCfg.Lastfm.User == "" || cfg.DiscoveryCfg.Lastfm.APIKey == "") {
+		errs = append(errs, errors.New("LASTFM_USER and LASTFM_API_KEY are required"))
+	}
+	users, err := cfg.ForUsers()
+	for _, user := range users {
+		lb := user.DiscoveryCfg.Listenbrainz
+		if slices.Contains(user.DiscoveryCfg.Discovery, "listenbrainz") && lb.UsesRadio() && lb.Token == "" {
+			tokenErr := errors.New("LISTENBRAINZ_TOKEN is required for LISTENBRAINZ_DISCOVERY=radio and LISTENBRAINZ_RADIO_PLAYLISTS")
+			if user.User != "" {
+				tokenErr = fmt.Errorf("%s: %s", user.User, tokenErr.Error())
+			}
+			errs = append(errs, tokenErr)
+		}
+	}
+	if err != nil {
+		errs = append(errs, err)
+	} else if cfg.Users != "" {
+		seen := make(map[string]bool)
+		playlistDirs := make(map[string]string)
+		for _, user := range users {
+			if seen[user.User] {
+				errs = append(errs, fmt.Errorf("EXPLO_USERS lists %s more than once", user.User))
+			}
+			seen[user.User] = true
+			for _, name := range names {
+				system, err := user.ForSystem(name)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %s", user.User, err.Error()))
+					continue
+				}
+				if user == users[0] && (name == "lms" || (name == "mpd" && system.ClientCfg.MPD.Address != "")) {
+					errs = append(errs, fmt.Errorf("%s has no users, playlists of EXPLO_USERS would overwrite each other", name))
+				}
+				if err := checkUserCreds(cfg, system, name); err != nil {
+					errs = append(errs, err)
+				}
+				if (name == "mpd" && system.ClientCfg.MPD.Address == "") || name == "kodi" { // M3U playlists of users would overwrite each other
+					key := name + system.ClientCfg.PlaylistDir
+					if other, ok := playlistDirs[key]; ok {
+						errs = append(errs, fmt.Errorf("%s and %s share the %s PLAYLIST_DIR, set %sPLAYLIST_DIR", other, user.User, name, envPrefix(user.User)))
+					}
+					playlistDirs[key] = user.User
+				}
+			}
+		}
+	}
+	if slices.Contains(cfg.DiscoveryCfg.Discovery, "file") {
+		if _, err := os.Stat(cfg.DiscoveryCfg.Files.Path); err != nil {
+			errs = append(errs, fmt.Errorf("FILE_DISCOVERY_PATH: %s", err.Error()))
+		}
+	}
+
+	for _, service := range cfg.DownloadCfg.Services {
+		if !slices.Contains(DownloadServices, service) {
+			errs = append(errs, fmt.Errorf("DOWNLOAD_SERVICES '%s' is not supported, use one of: %s", service, strings.Join(DownloadServices, ", ")))
+		}
+	}
+	if slices.Contains(cfg.DownloadCfg.Services, "youtube") && cfg.DownloadCfg.Youtube.APIKey == "" {
+		errs = append(errs, errors.New("YOUTUBE_API_KEY is required for youtube downloads"))
+	}
+	if slices.Contains(cfg.DownloadCfg.Services, "slskd") && (cfg.DownloadCfg.Slskd.URL == "" || cfg.DownloadCfg.Slskd.APIKey == "") {
+		errs = append(errs, errors.New("SLSKD_URL and SLSKD_API_KEY are required for slskd downloads"))
+	}
+	if info, err := os.Stat(cfg.DownloadCfg.DownloadDir); err != nil || !info.IsDir() {
+		errs = append(errs, fmt.Errorf("DOWNLOAD_DIR %s is not a directory", cfg.DownloadCfg.DownloadDir))
+	}
+
+	for _, name := range names {
+		if system, err := cfg.ForSystem(name); err == nil && system.ClientCfg.RefreshMode != "full" && system.ClientCfg.RefreshMode != "path" {
+			errs = append(errs, fmt.Errorf("REFRESH_MODE '%s' is not supported for %s, use full or path", system.ClientCfg.RefreshMode, name))
+		}
+	}
+
+	for _, criterion := range cfg.ClientCfg.Keep {
+		if !slices.Contains(KeepCriteria, criterion) {
+			errs = append(errs, fmt.Errorf("KEEP_TRACKS '%s' is not supported, use any of: %s", criterion, strings.Join(KeepCriteria, ", ")))
+		}
+	}
+	if cfg.DownloadCfg.KeepDir != "" {
+		if info, err := os.Stat(cfg.DownloadCfg.KeepDir); err != nil || !info.IsDir() {
+			errs = append(errs, fmt.Errorf("KEEP_DIR %s is not a directory", cfg.DownloadCfg.KeepDir))
+		} else if cfg.DownloadCfg.KeepDir == cfg.DownloadCfg.DownloadDir {
+			errs = append(errs, errors.New("KEEP_DIR has to differ from DOWNLOAD_DIR"))
+		}
+	}
+
+	if cfg.RetentionWeeks < 0 || cfg.RetentionDays < 0 {
+		errs = append(errs, errors.New("RETENTION_WEEKS and RETENTION_DAYS can't be negative"))
+	}
+	if cfg.RetentionWeeks > 0 && cfg.RetentionDays > 0 {
+		errs = append(errs, errors.New("set either RETENTION_WEEKS or RETENTION_DAYS"))
+	}
+
+	if cfg.ServerCfg.Review && cfg.ServerCfg.Address == "" {
+		errs = append(errs, errors.New("REVIEW requires HTTP_ADDR"))
+	}
+	if err := cfg.ServerCfg.CheckAuth(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (cfg ServerConfig) CheckAuth() error { // without HTTP_TOKEN anyone reaching the API can start runs and publish playlists, so only allow that on loopback
+	if cfg.Address == "" || cfg.Token != "" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(cfg.Address)
+	if err != nil {
+		return fmt.Errorf("HTTP_ADDR '%s': %s", cfg.Address, err.Error())
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("HTTP_TOKEN is required when HTTP_ADDR '%s' isn't a loopback address (e.g. 127.0.0.1:8080)", cfg.Address)
+	}
+	return nil
+}
+
+func (cfg *Config) SystemNames() []string { // systems listed in EXPLO_SYSTEM
+	var names []string
+	for _, name := range strings.Split(cfg.System, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (cfg *Config) ForSystem(name string) (*Config, error) { // config of one system, env vars prefixed with its name (e.g. JELLYFIN_API_KEY) override the shared music system settings
+	system := *cfg
+	system.System = name
+	system.ClientCfg.Creds.Headers = nil
+	if err := overrideEnv(reflect.ValueOf(&system.ClientCfg).Elem(), strings.ToUpper(name)+"_"); err != nil {
+		return nil, err
+	}
+	if cfg.User != "" { // user settings win over system settings, e.g. ALICE_SYSTEM_PASSWORD and ALICE_PLEX_SYSTEM_PASSWORD
+		system.ClientCfg.Creds.User = cfg.User
+		prefix := envPrefix(cfg.User)
+		for _, p := range []string{prefix, prefix + strings.ToUpper(name) + "_"} {
+			if err := overrideEnv(reflect.ValueOf(&system.ClientCfg).Elem(), p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	system.VerifyDir()
+	return &system, nil
+}
+
+func (cfg *Config) ForUsers() ([]*Config, error) { // config of each user in EXPLO_USERS, or only cfg if it's not set
+	if strings.TrimSpace(cfg.Users) == "" {
+		return []*Config{cfg}, nil
+	}
+
+	var users []*Config
+	for _, pair := range strings.Split(cfg.Users, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		listenbrainz, systemUser, found := strings.Cut(pair, ":")
+		if !found {
+			systemUser = listenbrainz
+		}
+		listenbrainz, systemUser = strings.TrimSpace(listenbrainz), strings.TrimSpace(systemUser)
+		if listenbrainz == "" || systemUser == "" {
+			return nil, fmt.Errorf("EXPLO_USERS entry '%s' should be listenbrainz_user:system_user", pair)
+		}
+
+		user := *cfg
+		user.User = systemUser
+		user.DiscoveryCfg.Listenbrainz.User = listenbrainz
+		if err := overrideEnv(reflect.ValueOf(&user.DiscoveryCfg).Elem(), envPrefix(systemUser)); err != nil { // e.g. ALICE_LASTFM_USER
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+	return users, nil
+}
+
+func checkUserCreds(cfg, system *Config, name string) error { // plex, ampache and funkwhale log in with the API key if set, a shared one puts every user's playlists in the same account
+	if name != "plex" && name != "ampache" && name != "funkwhale" {
+		return nil
+	}
+	shared, err := cfg.ForSystem(name)
+	if err != nil {
+		return nil // reported by the caller
+	}
+	if system.User == shared.ClientCfg.Creds.User { // the user the shared credentials belong to
+		return nil
+	}
+
+	creds, sharedCreds := system.ClientCfg.Creds, shared.ClientCfg.Creds
+	switch {
+	case creds.APIKey != "" && creds.APIKey == sharedCreds.APIKey:
+		return fmt.Errorf("%s uses the shared %s API key, set %sAPI_KEY", system.User, name, envPrefix(system.User))
+	case creds.APIKey == "" && creds.Password != "" && creds.Password == sharedCreds.Password:
+		return fmt.Errorf("%s uses the shared %s password, set %sSYSTEM_PASSWORD", system.User, name, envPrefix(system.User))
+	}
+	return nil
+}
+
+func envPrefix(name string) string { // ALICE_ for alice, characters that can't be in env var names are replaced
+	prefix := []rune(strings.ToUpper(name))
+	for i, r := range prefix {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			prefix[i] = '_'
+		}
+	}
+	return string(prefix) + "_"
+}
+
+func overrideEnv(v reflect.Value, prefix string) error { // set fields whose env var is set with the prefix
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			if err := overrideEnv(value, prefix); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name, ok := field.Tag.Lookup("env")
+		if !ok {
+			continue
+		}
+		raw, ok := os.LookupEnv(prefix + name)
+		if !ok {
+			continue
+		}
+
+		switch value.Kind() {
+		case reflect.String:
+			value.SetString(raw)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return fmt.Errorf("%s%s: %s", prefix, name, err.Error())
+			}
+			value.SetBool(b)
+		case reflect.Int:
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return fmt.Errorf("%s%s: %s", prefix, name, err.Error())
+			}
+			value.SetInt(int64(n))
+		case reflect.Slice:
+			if value.Type().Elem().Kind() == reflect.String {
+				value.Set(reflect.ValueOf(strings.Split(raw, ",")))
+			}
+		}
+	}
+	return nil
+}
+
 func (cfg *Config) VerifyDir() {
-	if cfg.System == "mpd" {
+	if (cfg.System == "mpd" && cfg.ClientCfg.MPD.Address == "") || cfg.System == "kodi" {
 		cfg.ClientCfg.PlaylistDir = fixDir(cfg.ClientCfg.PlaylistDir)
 	}
 	cfg.DownloadCfg.Slskd.SlskdDir = fixDir(cfg.DownloadCfg.Slskd.SlskdDir)
 	cfg.DownloadCfg.DownloadDir = fixDir(cfg.DownloadCfg.DownloadDir)
+	cfg.DownloadCfg.KeepDir = fixDir(cfg.DownloadCfg.KeepDir)
 }
 
 func fixDir(dir string) string {
@@ -146,11 +514,23 @@ func fixDir(dir string) string {
 	}
 }
  */
-func (cfg *Config) GetPlaylistName() { // Generate playlist name depending if user wants to keep it or not
-	playlistName := "Discover-Weekly"
-	if cfg.Persist {
-		year, week := time.Now().ISOWeek()
-		playlistName = fmt.Sprintf("%s-%d-Week%d", playlistName, year, week)
+func (cfg *Config) Retention() time.Duration { // how long playlists and downloads are kept, 0 if they're kept forever
+	if cfg.RetentionDays > 0 {
+		return time.Duration(cfg.RetentionDays) * 24 * time.Hour
+	}
+	return time.Duration(cfg.RetentionWeeks) * 7 * 24 * time.Hour
+}
+
+func (cfg *Config) GetPlaylistName(playlistName, period string) string { // Generate playlist name depending if user wants to keep it or not
+	if !cfg.Persist {
+		return playlistName
+	}
+	if period == "daily" { // daily playlists would collide with the one from the day before
+		return fmt.Sprintf("%s-%s", playlistName, time.Now().Format(time.DateOnly))
+	}
+	if period == "yearly" {
+		return fmt.Sprintf("%s-%d", playlistName, time.Now().Year())
 	}
-	cfg.ClientCfg.PlaylistName = playlistName
+	year, week := time.Now().ISOWeek()
+	return fmt.Sprintf("%s-%d-Week%d", playlistName, year, week)
 }
@@ -1,31 +1,240 @@
 package discovery
 
 import (
-	"explo/src/models"
+	"fmt"
+	"log"
+	"strings"
+
 	cfg "explo/src/config"
+	"explo/src/models"
 	"explo/src/util"
 )
 
 type DiscoverClient struct {
-	cfg *cfg.DiscoveryConfig
+	cfg     *cfg.DiscoveryConfig
+	Sources []Source
+}
+
+type Source struct {
+	Name      string
+	Weight    int // Number of tracks taken from this source per blending round
 	Discovery Discovery
 }
+
 type Discovery interface {
 	QueryTracks() ([]*models.Track, error)
 }
 
-func NewDiscoverer(cfg cfg.DiscoveryConfig, httpClient *util.HttpClient) *DiscoverClient {
+// PlaylistDiscovery is implemented by services that generate complete playlists,
+// these are mirrored as separate playlists instead of being blended
+type PlaylistDiscovery interface {
+	QueryPlaylists() ([]*models.Playlist, error)
+}
+
+const DiscoverWeekly = "Discover-Weekly" // Base name of the blended playlist
+
+var serviceNames = map[string]string{
+	"listenbrainz": "ListenBrainz",
+	"lastfm":       "Last.fm",
+	"file":         "local files",
+	"library":      "your library",
+}
+
+func NewDiscoverer(cfg cfg.DiscoveryConfig, httpClient *util.HttpClient, artists ArtistLister) (*DiscoverClient, error) { // get discovery services from config and append them to DiscoverClient
 	c := &DiscoverClient{cfg: &cfg}
 
-	switch cfg.Discovery {
-	case "listenbrainz":
-		c.Discovery = NewListenBrainz(cfg, httpClient)
-	default:
-		return nil
+	for _, service := range cfg.Discovery {
+		source := Source{Name: service, Weight: 1}
+		if weight, ok := cfg.Weights[service]; ok && weight > 0 {
+			source.Weight = weight
+		}
+
+		switch service {
+		case "listenbrainz":
+			if cfg.Listenbrainz.UsesRadio() && cfg.Listenbrainz.Token == "" { // config.Validate explains it before the run
+				return nil, fmt.Errorf("[listenbrainz] radio needs a token")
+			}
+			source.Discovery = NewListenBrainz(cfg, httpClient)
+		case "lastfm":
+			source.Discovery = NewLastfm(cfg, httpClient)
+		case "file":
+			source.Discovery = NewFiles(cfg)
+		case "library":
+			source.Discovery = NewLibrary(cfg, httpClient, artists)
+		default:
+			return nil, fmt.Errorf("discovery service '%s' not supported", service)
+		}
+		c.Sources = append(c.Sources, source)
+	}
+	return c, nil
+}
+
+func (c *DiscoverClient) Discover() ([]*models.Playlist, error) { // blend source tracks into one playlist and add playlists mirrored from sources
+	var playlists []*models.Playlist
+
+	tracks, err := c.discoverTracks()
+	if err != nil {
+		log.Println(err.Error())
+	} else if len(tracks) > 0 {
+		playlists = append(playlists, &models.Playlist{
+			Name:        DiscoverWeekly,
+			Description: fmt.Sprintf("Created by Explo using recommendations from %s", c.serviceNames()),
+			Tracks:      tracks,
+		})
+	}
+
+	for _, source := range c.Sources {
+		playlistSource, ok := source.Discovery.(PlaylistDiscovery)
+		if !ok {
+			continue
+		}
+		mirrored, err := playlistSource.QueryPlaylists()
+		if err != nil {
+			log.Printf("[%s] failed to get playlists: %s", source.Name, err.Error())
+			continue
+		}
+		playlists = append(playlists, mirrored...)
+	}
+
+	if len(playlists) == 0 {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("no tracks were discovered")
 	}
-	return c
+
+	ShareTracks(playlists)
+	return playlists, nil
 }
 
-func (c *DiscoverClient) Discover() ([]*models.Track, error) {
-	return c.Discovery.QueryTracks()
-}
\ No newline at end of file
+func (c *DiscoverClient) discoverTracks() ([]*models.Track, error) { // query every source and blend the results into a single list
+	results := make([][]*models.Track, len(c.Sources))
+	var errs []string
+
+	for i, source := range c.Sources {
+		tracks, err := source.Discovery.QueryTracks()
+		if err != nil {
+			log.Printf("[%s] discovery failed: %s", source.Name, err.Error())
+			errs = append(errs, fmt.Sprintf("%s: %s", source.Name, err.Error()))
+			continue
+		}
+		log.Printf("[%s] discovered %d tracks", source.Name, len(tracks))
+		results[i] = tracks
+	}
+
+	if len(errs) == len(c.Sources) {
+		return nil, fmt.Errorf("no discovery service returned tracks: %s", strings.Join(errs, "; "))
+	}
+
+	if len(c.Sources) == 1 {
+		return limitTracks(dedupeTracks(results[0]), c.cfg.Limit), nil
+	}
+	return c.blend(results), nil
+}
+
+func (c *DiscoverClient) serviceNames() string {
+	names := make([]string, 0, len(c.Sources))
+	for _, source := range c.Sources {
+		if name, ok := serviceNames[source.Name]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, source.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func (c *DiscoverClient) blend(results [][]*models.Track) []*models.Track { // interleave sources by weight, skipping duplicates
+	var blended []*models.Track
+	seen := newTrackSet()
+	positions := make([]int, len(results))
+
+	for {
+		added := false
+		for i, source := range c.Sources {
+			taken := 0
+			for taken < source.Weight && positions[i] < len(results[i]) {
+				track := results[i][positions[i]]
+				positions[i]++
+				added = true
+
+				if !seen.add(track) {
+					continue
+				}
+				blended = append(blended, track)
+				taken++
+
+				if c.cfg.Limit > 0 && len(blended) >= c.cfg.Limit {
+					return blended
+				}
+			}
+		}
+		if !added {
+			return blended
+		}
+	}
+}
+
+type trackSet struct {
+	mbids map[string]*models.Track
+	names map[string]*models.Track
+}
+
+func newTrackSet() *trackSet {
+	return &trackSet{
+		mbids: make(map[string]*models.Track),
+		names: make(map[string]*models.Track),
+	}
+}
+
+func (s *trackSet) find(track *models.Track) *models.Track { // find an added track by MBID or normalized artist and title
+	if track.RecordingMBID != "" {
+		if found, ok := s.mbids[track.RecordingMBID]; ok {
+			return found
+		}
+	}
+	return s.names[util.NameKey(track)]
+}
+
+func (s *trackSet) add(track *models.Track) bool { // returns false if the track was already added
+	if s.find(track) != nil {
+		return false
+	}
+
+	s.names[util.NameKey(track)] = track
+	if track.RecordingMBID != "" {
+		s.mbids[track.RecordingMBID] = track
+	}
+	return true
+}
+
+func dedupeTracks(tracks []*models.Track) []*models.Track {
+	seen := newTrackSet()
+	deduped := tracks[:0]
+	for _, track := range tracks {
+		if seen.add(track) {
+			deduped = append(deduped, track)
+		}
+	}
+	return deduped
+}
+
+func ShareTracks(playlists []*models.Playlist) { // point duplicate tracks across playlists to the same track, so it's only downloaded once
+	seen := newTrackSet()
+	for _, playlist := range playlists {
+		for i, track := range playlist.Tracks {
+			if found := seen.find(track); found != nil {
+				playlist.Tracks[i] = found
+				continue
+			}
+			seen.add(track)
+		}
+	}
+}
+
+func limitTracks(tracks []*models.Track, limit int) []*models.Track {
+	if limit > 0 && len(tracks) > limit {
+		return tracks[:limit]
+	}
+	return tracks
+}
@@ -0,0 +1,346 @@
+package discovery
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	cfg "explo/src/config"
+	"explo/src/models"
+)
+
+type XSPF struct {
+	Title  string `xml:"title"`
+	Tracks []struct {
+		Location   string `xml:"location"`
+		Identifier string `xml:"identifier"`
+		Title      string `xml:"title"`
+		Creator    string `xml:"creator"`
+		Album      string `xml:"album"`
+		Duration   int    `xml:"duration"` // in milliseconds
+	} `xml:"trackList>track"`
+}
+
+var supportedLists = []string{".jspf", ".json", ".xspf", ".m3u", ".m3u8", ".csv"}
+
+type Files struct {
+	cfg          cfg.Files
+	singleArtist bool
+}
+
+func NewFiles(cfg cfg.DiscoveryConfig) *Files {
+	return &Files{
+		cfg:          cfg.Files,
+		singleArtist: cfg.Listenbrainz.SingleArtist,
+	}
+}
+
+func (c *Files) QueryTracks() ([]*models.Track, error) {
+	if c.cfg.AsPlaylists {
+		return nil, nil
+	}
+
+	paths, err := c.listFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var tracks []*models.Track
+	for _, path := range paths {
+		fileTracks, err := ParseFile(path, c.singleArtist)
+		if err != nil {
+			log.Printf("[file] %s", err.Error())
+			continue
+		}
+		tracks = append(tracks, fileTracks...)
+	}
+
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("no tracks found in %s", c.cfg.Path)
+	}
+	return tracks, nil
+}
+
+func (c *Files) QueryPlaylists() ([]*models.Playlist, error) { // create a playlist from each file
+	if !c.cfg.AsPlaylists {
+		return nil, nil
+	}
+
+	paths, err := c.listFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var playlists []*models.Playlist
+	for _, path := range paths {
+		tracks, err := ParseFile(path, c.singleArtist)
+		if err != nil {
+			log.Printf("[file] %s", err.Error())
+			continue
+		}
+
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		playlists = append(playlists, &models.Playlist{
+			Name:        name,
+			Description: fmt.Sprintf("Created by Explo from %s", filepath.Base(path)),
+			Tracks:      tracks,
+		})
+	}
+	return playlists, nil
+}
+
+func (c *Files) listFiles() ([]string, error) { // get supported files from path, sorted by name
+	if c.cfg.Path == "" {
+		return nil, fmt.Errorf("FILE_DISCOVERY_PATH is required")
+	}
+
+	info, err := os.Stat(c.cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %s", c.cfg.Path, err.Error())
+	}
+	if !info.IsDir() {
+		return []string{c.cfg.Path}, nil
+	}
+
+	entries, err := os.ReadDir(c.cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %s", err.Error())
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		if !entry.IsDir() && slices.Contains(supportedLists, strings.ToLower(filepath.Ext(entry.Name()))) {
+			paths = append(paths, filepath.Join(c.cfg.Path, entry.Name()))
+		}
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no supported files (%s) found in %s", strings.Join(supportedLists, ", "), c.cfg.Path)
+	}
+	return paths, nil
+}
+
+// ParseFile reads tracks from a JSPF, XSPF, M3U or CSV file
+func ParseFile(path string, singleArtist bool) ([]*models.Track, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %s", path, err.Error())
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Printf("warning: failed to close %s: %s", path, err.Error())
+		}
+	}()
+
+	var tracks []*models.Track
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jspf", ".json":
+		tracks, err = parseJSPF(f, singleArtist)
+	case ".xspf":
+		tracks, err = parseXSPF(f)
+	case ".m3u", ".m3u8":
+		tracks, err = parseM3U(f)
+	case ".csv":
+		tracks, err = parseCSV(f)
+	default:
+		return nil, fmt.Errorf("unsupported file type: %s", path)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %s", path, err.Error())
+	}
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("no tracks found in %s", path)
+	}
+	return tracks, nil
+}
+
+func parseJSPF(r io.Reader, singleArtist bool) ([]*models.Track, error) {
+	var exploration Exploration
+	if err := json.NewDecoder(r).Decode(&exploration); err != nil {
+		return nil, err
+	}
+	return parseJSPFTracks(exploration, singleArtist), nil
+}
+
+func parseXSPF(r io.Reader) ([]*models.Track, error) {
+	var playlist XSPF
+	if err := xml.NewDecoder(r).Decode(&playlist); err != nil {
+		return nil, err
+	}
+
+	tracks := make([]*models.Track, 0, len(playlist.Tracks))
+	for _, track := range playlist.Tracks {
+		if track.Title == "" || track.Creator == "" {
+			continue
+		}
+		tracks = append(tracks, &models.Track{
+			RecordingMBID: parseMBID([]string{track.Identifier}, "recording"),
+			Album:         track.Album,
+			Artist:        track.Creator,
+			MainArtist:    track.Creator,
+			CleanTitle:    track.Title,
+			Title:         track.Title,
+			Duration:      track.Duration,
+		})
+	}
+	return tracks, nil
+}
+
+func parseM3U(r io.Reader) ([]*models.Track, error) { // parse '#EXTINF:<seconds>,<artist> - <title>' entries
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var tracks []*models.Track
+	for _, line := range strings.Split(string(data), "\n") {
+		info, found := strings.CutPrefix(strings.TrimSpace(line), "#EXTINF:")
+		if !found {
+			continue
+		}
+
+		seconds, details, found := strings.Cut(info, ",")
+		if !found {
+			continue
+		}
+		artist, title, found := strings.Cut(details, " - ")
+		if !found {
+			log.Printf("[file] skipping '%s', expected 'artist - title'", details)
+			continue
+		}
+
+		track := newTrack(artist, title, "")
+		if duration, err := strconv.Atoi(strings.TrimSpace(seconds)); err == nil && duration > 0 {
+			track.Duration = duration * 1000
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, nil
+}
+
+func parseCSV(r io.Reader) ([]*models.Track, error) { // parse 'artist,title,album,duration' rows, duration is in seconds (or milliseconds if the header says 'ms')
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := map[string]int{"artist": 0, "title": 1, "album": 2, "duration": 3}
+	durationMS := false
+	if header, ok := parseCSVHeader(records[0]); ok {
+		columns = header
+		if i, ok := columns["duration"]; ok {
+			durationMS = strings.Contains(strings.ToLower(records[0][i]), "ms")
+		}
+		records = records[1:]
+	}
+
+	field := func(record []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	tracks := make([]*models.Track, 0, len(records))
+	for _, record := range records {
+		artist, title := field(record, "artist"), field(record, "title")
+		if artist == "" || title == "" {
+			continue
+		}
+
+		track := newTrack(artist, title, field(record, "album"))
+		if duration, err := strconv.Atoi(field(record, "duration")); err == nil && duration > 0 {
+			if !durationMS {
+				duration *= 1000
+			}
+			track.Duration = duration
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, nil
+}
+
+func parseCSVHeader(record []string) (map[string]int, bool) { // map column names to indexes, if the first row is a header
+	columns := make(map[string]int)
+	set := func(column string, i int) { // first matching column wins
+		if _, ok := columns[column]; !ok {
+			columns[column] = i
+		}
+	}
+
+	for i, name := range record {
+		name = strings.ToLower(name)
+		switch {
+		case strings.Contains(name, "uri") || strings.HasSuffix(name, "id"): // skip identifier columns (e.g. "Track URI")
+			continue
+		case strings.Contains(name, "duration") || strings.Contains(name, "length"):
+			set("duration", i)
+		case strings.Contains(name, "album"):
+			set("album", i)
+		case strings.Contains(name, "artist"):
+			set("artist", i)
+		case strings.Contains(name, "title") || strings.Contains(name, "track"):
+			set("title", i)
+		}
+	}
+
+	_, hasArtist := columns["artist"]
+	_, hasTitle := columns["title"]
+	return columns, hasArtist && hasTitle
+}
+
+func ToJSPF(playlist *models.Playlist) Exploration { // JSPF playlist in the format ListenBrainz uses, so it can be read back by ParseFile
+	var jspf Exploration
+	jspf.Playlist.Title = playlist.Name
+	jspf.Playlist.Annotation = playlist.Description
+	jspf.Playlist.Creator = "Explo"
+	jspf.Playlist.Date = time.Now()
+	jspf.Playlist.Tracks = make([]JSPFTrack, 0, len(playlist.Tracks))
+
+	for _, track := range playlist.Tracks {
+		jspfTrack := JSPFTrack{
+			Title:    track.CleanTitle,
+			Creator:  track.Artist,
+			Album:    track.Album,
+			Duration: track.Duration,
+		}
+		if track.RecordingMBID != "" {
+			jspfTrack.Identifier = []string{"https://musicbrainz.org/recording/" + track.RecordingMBID}
+		}
+		extension := &jspfTrack.Extension.HTTPSMusicbrainzOrgDocJspfTrack
+		if track.ArtistMBID != "" {
+			extension.ArtistIdentifiers = []string{"https://musicbrainz.org/artist/" + track.ArtistMBID}
+		}
+		extension.AdditionalMetadata.CaaReleaseMbid = track.CoverArtMBID
+		jspf.Playlist.Tracks = append(jspf.Playlist.Tracks, jspfTrack)
+	}
+	return jspf
+}
+
+func newTrack(artist, title, album string) *models.Track {
+	artist, title = strings.TrimSpace(artist), strings.TrimSpace(title)
+	return &models.Track{
+		Album:      strings.TrimSpace(album),
+		Artist:     artist,
+		MainArtist: artist,
+		CleanTitle: title,
+		Title:      title,
+	}
+}
@@ -0,0 +1,141 @@
+package discovery
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"explo/src/models"
+)
+
+const mbid = "8f3471b5-7e6a-48da-86a9-c1c07a0f47ae"
+
+func TestParseFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func(io.Reader) ([]*models.Track, error)
+		input string
+		want  []models.Track
+	}{
+		{
+			name:  "jspf",
+			parse: func(r io.Reader) ([]*models.Track, error) { return parseJSPF(r, false) },
+			input: `{"playlist": {"title": "Mix", "track": [
+				{"title": "Teardrop", "creator": "Massive Attack", "album": "Mezzanine", "duration": 330000,
+				 "identifier": ["https://musicbrainz.org/recording/` + mbid + `"],
+				 "extension": {"https://musicbrainz.org/doc/jspf#track": {"artist_identifiers": ["https://musicbrainz.org/artist/` + mbid + `"]}}},
+				{"title": "Roads", "creator": "Portishead", "identifier": ["https://open.spotify.com/track/2Ugz4ipXhTwVlJ9hOTVtzz"]}
+			]}}`,
+			want: []models.Track{
+				{RecordingMBID: mbid, ArtistMBID: mbid, Album: "Mezzanine", Artist: "Massive Attack", MainArtist: "Massive Attack", CleanTitle: "Teardrop", Title: "Teardrop", Duration: 330000},
+				{Artist: "Portishead", MainArtist: "Portishead", CleanTitle: "Roads", Title: "Roads"},
+			},
+		},
+		{
+			name:  "xspf",
+			parse: parseXSPF,
+			input: `<?xml version="1.0" encoding="UTF-8"?>
+				<playlist version="1" xmlns="http://xspf.org/ns/0/"><trackList>
+					<track><title>Teardrop</title><creator>Massive Attack</creator><album>Mezzanine</album><duration>330000</duration><identifier>https://musicbrainz.org/recording/` + mbid + `</identifier></track>
+					<track><title>Roads</title><creator>Portishead</creator><identifier>https://www.youtube.com/watch?v=Vg1jyL3cr60</identifier></track>
+					<track><location>file:///music/no-tags.mp3</location></track>
+				</trackList></playlist>`,
+			want: []models.Track{
+				{RecordingMBID: mbid, Album: "Mezzanine", Artist: "Massive Attack", MainArtist: "Massive Attack", CleanTitle: "Teardrop", Title: "Teardrop", Duration: 330000},
+				{Artist: "Portishead", MainArtist: "Portishead", CleanTitle: "Roads", Title: "Roads"},
+			},
+		},
+		{
+			name:  "m3u",
+			parse: parseM3U,
+			input: "#EXTM3U\r\n#EXTINF:330,Massive Attack - Teardrop\r\n/music/teardrop.mp3\n#EXTINF:-1,Portishead - Roads\nroads.mp3\n#EXTINF:100,No Separator\n",
+			want: []models.Track{
+				{Artist: "Massive Attack", MainArtist: "Massive Attack", CleanTitle: "Teardrop", Title: "Teardrop", Duration: 330000},
+				{Artist: "Portishead", MainArtist: "Portishead", CleanTitle: "Roads", Title: "Roads"},
+			},
+		},
+		{
+			name:  "csv without header",
+			parse: parseCSV,
+			input: "Massive Attack,Teardrop,Mezzanine,330\nPortishead,Roads\n,Missing Artist\n",
+			want: []models.Track{
+				{Album: "Mezzanine", Artist: "Massive Attack", MainArtist: "Massive Attack", CleanTitle: "Teardrop", Title: "Teardrop", Duration: 330000},
+				{Artist: "Portishead", MainArtist: "Portishead", CleanTitle: "Roads", Title: "Roads"},
+			},
+		},
+		{
+			name:  "csv with header",
+			parse: parseCSV,
+			input: "Track URI,Track Name,Artist Name(s),Album Name,Duration (ms)\nspotify:track:1,Teardrop,Massive Attack,Mezzanine,330000\n",
+			want: []models.Track{
+				{Album: "Mezzanine", Artist: "Massive Attack", MainArtist: "Massive Attack", CleanTitle: "Teardrop", Title: "Teardrop", Duration: 330000},
+			},
+		},
+		{
+			name:  "csv with header in seconds",
+			parse: parseCSV,
+			input: "title,artist,length\nTeardrop,Massive Attack,330\n",
+			want: []models.Track{
+				{Artist: "Massive Attack", MainArtist: "Massive Attack", CleanTitle: "Teardrop", Title: "Teardrop", Duration: 330000},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracks, err := test.parse(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatalf("parse: %s", err.Error())
+			}
+			got := make([]models.Track, 0, len(tracks))
+			for _, track := range tracks {
+				got = append(got, *track)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseMBID(t *testing.T) {
+	tests := []struct {
+		identifier string
+		entity     string
+		want       string
+	}{
+		{"https://musicbrainz.org/recording/" + mbid, "recording", mbid},
+		{"http://musicbrainz.org/recording/" + strings.ToUpper(mbid) + "/", "recording", mbid},
+		{"https://musicbrainz.org/artist/" + mbid, "recording", ""},
+		{"https://musicbrainz.org/recording/not-an-mbid", "recording", ""},
+		{"https://open.spotify.com/track/" + mbid, "recording", ""},
+		{mbid, "recording", ""},
+		{"", "recording", ""},
+	}
+
+	for _, test := range tests {
+		if got := parseMBID([]string{test.identifier}, test.entity); got != test.want {
+			t.Errorf("parseMBID(%q, %q) = %q, want %q", test.identifier, test.entity, got, test.want)
+		}
+	}
+}
+
+func TestToJSPF(t *testing.T) { // exported playlists are read back unchanged
+	want := models.Track{RecordingMBID: mbid, ArtistMBID: mbid, CoverArtMBID: mbid, Album: "Mezzanine", Artist: "Massive Attack", MainArtist: "Massive Attack", CleanTitle: "Teardrop", Title: "Teardrop", Duration: 330000}
+	track := want
+	data, err := json.Marshal(ToJSPF(&models.Playlist{Name: "Mix", Tracks: []*models.Track{&track}}))
+	if err != nil {
+		t.Fatalf("marshal: %s", err.Error())
+	}
+
+	tracks, err := parseJSPF(bytes.NewReader(data), false)
+	if err != nil {
+		t.Fatalf("parse: %s", err.Error())
+	}
+	if len(tracks) != 1 || !reflect.DeepEqual(*tracks[0], want) {
+		t.Errorf("got %+v from %s, want %+v", tracks, data, want)
+	}
+}
@@ -0,0 +1,335 @@
+package discovery
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	cfg "explo/src/config"
+	"explo/src/debug"
+	"explo/src/models"
+	"explo/src/util"
+)
+
+type LfmError struct {
+	Error   int    `json:"error"`
+	Message string `json:"message"`
+}
+
+type LfmArtist struct {
+	Name  string `json:"name"`
+	Mbid  string `json:"mbid"`
+	Match string `json:"match,omitempty"`
+}
+
+type LfmTrack struct {
+	Name   string    `json:"name"`
+	Mbid   string    `json:"mbid"`
+	Match  float64   `json:"match,omitempty"`
+	Artist LfmArtist `json:"artist"`
+}
+
+type LfmTopArtists struct {
+	TopArtists struct {
+		Artist []LfmArtist `json:"artist"`
+	} `json:"topartists"`
+}
+
+type LfmSimilarArtists struct {
+	SimilarArtists struct {
+		Artist []LfmArtist `json:"artist"`
+	} `json:"similarartists"`
+}
+
+type LfmTopTracks struct {
+	TopTracks struct {
+		Track []LfmTrack `json:"track"`
+	} `json:"toptracks"`
+}
+
+type LfmSimilarTracks struct {
+	SimilarTracks struct {
+		Track []LfmTrack `json:"track"`
+	} `json:"similartracks"`
+}
+
+type LfmTrackInfo struct {
+	Track struct {
+		Name     string    `json:"name"`
+		Mbid     string    `json:"mbid"`
+		Duration string    `json:"duration"` // in milliseconds
+		Artist   LfmArtist `json:"artist"`
+		Album    struct {
+			Artist string `json:"artist"`
+			Title  string `json:"title"`
+			Mbid   string `json:"mbid"`
+		} `json:"album"`
+	} `json:"track"`
+}
+
+type Lastfm struct {
+	HttpClient *util.HttpClient
+	cfg        cfg.Lastfm
+}
+
+func NewLastfm(cfg cfg.DiscoveryConfig, httpClient *util.HttpClient) *Lastfm {
+	return &Lastfm{
+		cfg:        cfg.Lastfm,
+		HttpClient: httpClient,
+	}
+}
+
+func (c *Lastfm) QueryTracks() ([]*models.Track, error) {
+	if c.cfg.User == "" || c.cfg.APIKey == "" {
+		return nil, fmt.Errorf("LASTFM_USER and LASTFM_API_KEY are required")
+	}
+
+	var (
+		candidates []LfmTrack
+		err        error
+	)
+
+	switch c.cfg.Discovery {
+	case "tracks":
+		candidates, err = c.getSimilarTracks()
+	default:
+		candidates, err = c.getSimilarArtistTracks()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no recommendations found for Last.fm user %s", c.cfg.User)
+	}
+	return c.getTracks(candidates), nil
+}
+
+func (c *Lastfm) getSimilarArtistTracks() ([]LfmTrack, error) { // Recommend top tracks of artists similar to the user's top artists
+	topArtists, err := c.getTopArtists()
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(topArtists))
+	for _, artist := range topArtists {
+		known[strings.ToLower(artist.Name)] = true
+	}
+
+	seeds := topArtists[:min(c.cfg.Seeds, len(topArtists))]
+	perSeed := max(c.cfg.Limit/max(len(seeds), 1), 1)
+
+	var tracks []LfmTrack
+	for _, seed := range seeds {
+		similar, err := c.getSimilarArtists(seed.Name, perSeed*2)
+		if err != nil {
+			debug.Debug(err.Error())
+			continue
+		}
+
+		added := 0
+		for _, artist := range similar {
+			if added >= perSeed {
+				break
+			}
+			if known[strings.ToLower(artist.Name)] {
+				continue
+			}
+			known[strings.ToLower(artist.Name)] = true
+
+			topTracks, err := c.getArtistTopTracks(artist.Name, 1)
+			if err != nil || len(topTracks) == 0 {
+				debug.Debug(fmt.Sprintf("[lastfm] no top tracks for %s", artist.Name))
+				continue
+			}
+			tracks = append(tracks, topTracks[0])
+			added++
+		}
+	}
+	return tracks, nil
+}
+
+func (c *Lastfm) getSimilarTracks() ([]LfmTrack, error) { // Recommend tracks similar to the user's top tracks
+	body, err := c.lfmRequest("user.gettoptracks", url.Values{
+		"user":   {c.cfg.User},
+		"period": {c.cfg.Period},
+		"limit":  {strconv.Itoa(max(c.cfg.Seeds, 50))},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getSimilarTracks(): %s", err.Error())
+	}
+
+	var topTracks LfmTopTracks
+	if err = util.ParseResp(body, &topTracks); err != nil {
+		return nil, fmt.Errorf("getSimilarTracks(): %s", err.Error())
+	}
+
+	known := make(map[string]bool, len(topTracks.TopTracks.Track))
+	for _, track := range topTracks.TopTracks.Track {
+		known[trackKey(track)] = true
+	}
+
+	seeds := topTracks.TopTracks.Track[:min(c.cfg.Seeds, len(topTracks.TopTracks.Track))]
+	perSeed := max(c.cfg.Limit/max(len(seeds), 1), 1)
+
+	var tracks []LfmTrack
+	for _, seed := range seeds {
+		body, err := c.lfmRequest("track.getsimilar", url.Values{
+			"artist": {seed.Artist.Name},
+			"track":  {seed.Name},
+			"limit":  {strconv.Itoa(perSeed * 2)},
+		})
+		if err != nil {
+			debug.Debug(err.Error())
+			continue
+		}
+
+		var similar LfmSimilarTracks
+		if err = util.ParseResp(body, &similar); err != nil {
+			debug.Debug(err.Error())
+			continue
+		}
+
+		added := 0
+		for _, track := range similar.SimilarTracks.Track {
+			if added >= perSeed {
+				break
+			}
+			if known[trackKey(track)] {
+				continue
+			}
+			known[trackKey(track)] = true
+			tracks = append(tracks, track)
+			added++
+		}
+	}
+	return tracks, nil
+}
+
+func (c *Lastfm) getTopArtists() ([]LfmArtist, error) {
+	body, err := c.lfmRequest("user.gettopartists", url.Values{
+		"user":   {c.cfg.User},
+		"period": {c.cfg.Period},
+		"limit":  {strconv.Itoa(max(c.cfg.Seeds, 50))}, // fetch more than needed, so known artists can be filtered out
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getTopArtists(): %s", err.Error())
+	}
+
+	var topArtists LfmTopArtists
+	if err = util.ParseResp(body, &topArtists); err != nil {
+		return nil, fmt.Errorf("getTopArtists(): %s", err.Error())
+	}
+
+	if len(topArtists.TopArtists.Artist) == 0 {
+		return nil, fmt.Errorf("no top artists found for Last.fm user %s", c.cfg.User)
+	}
+	return topArtists.TopArtists.Artist, nil
+}
+
+func (c *Lastfm) getSimilarArtists(artist string, limit int) ([]LfmArtist, error) {
+	body, err := c.lfmRequest("artist.getsimilar", url.Values{
+		"artist": {artist},
+		"limit":  {strconv.Itoa(limit)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getSimilarArtists(): %s", err.Error())
+	}
+
+	var similar LfmSimilarArtists
+	if err = util.ParseResp(body, &similar); err != nil {
+		return nil, fmt.Errorf("getSimilarArtists(): %s", err.Error())
+	}
+	return similar.SimilarArtists.Artist, nil
+}
+
+func (c *Lastfm) getArtistTopTracks(artist string, limit int) ([]LfmTrack, error) {
+	body, err := c.lfmRequest("artist.gettoptracks", url.Values{
+		"artist": {artist},
+		"limit":  {strconv.Itoa(limit)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getArtistTopTracks(): %s", err.Error())
+	}
+
+	var topTracks LfmTopTracks
+	if err = util.ParseResp(body, &topTracks); err != nil {
+		return nil, fmt.Errorf("getArtistTopTracks(): %s", err.Error())
+	}
+	return topTracks.TopTracks.Track, nil
+}
+
+func (c *Lastfm) getTracks(candidates []LfmTrack) []*models.Track { // Look up album and duration for each candidate
+	tracks := make([]*models.Track, 0, min(len(candidates), c.cfg.Limit))
+	for _, candidate := range candidates {
+		if len(tracks) >= c.cfg.Limit {
+			break
+		}
+
+		track := &models.Track{
+			RecordingMBID: candidate.Mbid,
+			ArtistMBID:    candidate.Artist.Mbid,
+			Artist:        candidate.Artist.Name,
+			MainArtist:    candidate.Artist.Name,
+			CleanTitle:    candidate.Name,
+			Title:         candidate.Name,
+		}
+
+		body, err := c.lfmRequest("track.getinfo", url.Values{
+			"artist": {candidate.Artist.Name},
+			"track":  {candidate.Name},
+		})
+		if err != nil {
+			debug.Debug(fmt.Sprintf("[lastfm] failed to get info for %s - %s: %s", candidate.Name, candidate.Artist.Name, err.Error()))
+			tracks = append(tracks, track)
+			continue
+		}
+
+		var info LfmTrackInfo
+		if err = util.ParseResp(body, &info); err != nil {
+			debug.Debug(err.Error())
+			tracks = append(tracks, track)
+			continue
+		}
+
+		track.Album = info.Track.Album.Title
+		track.AlbumArtist = info.Track.Album.Artist
+		track.ReleaseMBID = info.Track.Album.Mbid
+		if track.RecordingMBID == "" {
+			track.RecordingMBID = info.Track.Mbid
+		}
+		if track.ArtistMBID == "" {
+			track.ArtistMBID = info.Track.Artist.Mbid
+		}
+		if duration, err := strconv.Atoi(info.Track.Duration); err == nil {
+			track.Duration = duration
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks
+}
+
+func (c *Lastfm) lfmRequest(method string, params url.Values) ([]byte, error) { // Handle Last.fm API requests
+	params.Set("method", method)
+	params.Set("api_key", c.cfg.APIKey)
+	params.Set("format", "json")
+	params.Set("autocorrect", "1")
+
+	reqURL := fmt.Sprintf("%s?%s", c.cfg.URL, params.Encode())
+
+	body, err := c.HttpClient.MakeRequest("GET", reqURL, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request to Last.fm API: %s", err)
+	}
+
+	var lfmErr LfmError
+	if err = util.ParseResp(body, &lfmErr); err == nil && lfmErr.Error != 0 {
+		return nil, fmt.Errorf("Last.fm API returned error %d: %s", lfmErr.Error, lfmErr.Message)
+	}
+	return body, nil
+}
+
+func trackKey(track LfmTrack) string {
+	return strings.ToLower(track.Artist.Name + "|" + track.Name)
+}
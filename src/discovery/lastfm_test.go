@@ -0,0 +1,147 @@
+package discovery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	cfg "explo/src/config"
+	"explo/src/models"
+	"explo/src/util"
+)
+
+// lastfmResponses maps method and artist/track parameters to Last.fm API responses
+var lastfmResponses = map[string]string{
+	"user.gettopartists": `{"topartists": {"artist": [{"name": "Massive Attack", "mbid": "` + mbid + `"}, {"name": "Portishead"}]}}`,
+	"artist.getsimilar|Massive Attack": `{"similarartists": {"artist": [
+		{"name": "portishead", "match": "0.9"}, {"name": "Tricky", "match": "0.8"}, {"name": "Unknown Band", "match": "0.7"}, {"name": "Morcheeba", "match": "0.6"}]}}`,
+	"artist.getsimilar|Portishead":     `{"similarartists": {"artist": [{"name": "Tricky"}, {"name": "Beth Gibbons"}]}}`,
+	"artist.gettoptracks|Tricky":       `{"toptracks": {"track": [{"name": "Hell Is Round the Corner", "mbid": "` + mbid + `", "artist": {"name": "Tricky"}}]}}`,
+	"artist.gettoptracks|Unknown Band": `{"toptracks": {"track": []}}`,
+	"artist.gettoptracks|Morcheeba":    `{"toptracks": {"track": [{"name": "The Sea", "artist": {"name": "Morcheeba"}}]}}`,
+	"artist.gettoptracks|Beth Gibbons": `{"toptracks": {"track": [{"name": "Floating on a Moment", "artist": {"name": "Beth Gibbons"}}]}}`,
+	"track.getinfo|Tricky|Hell Is Round the Corner": `{"track": {"name": "Hell Is Round the Corner", "duration": "228000",
+		"artist": {"name": "Tricky", "mbid": "` + mbid + `"}, "album": {"artist": "Tricky", "title": "Maxinquaye", "mbid": "` + mbid + `"}}}`,
+	"track.getinfo|Morcheeba|The Sea":                 `{"error": 6, "message": "Track not found"}`,
+	"track.getinfo|Beth Gibbons|Floating on a Moment": `{"track": {"name": "Floating on a Moment", "mbid": "` + mbid + `", "duration": "0", "artist": {"name": "Beth Gibbons"}, "album": {"title": "Lives Outgrown"}}}`,
+	"user.gettoptracks":                               `{"toptracks": {"track": [{"name": "Teardrop", "artist": {"name": "Massive Attack"}}, {"name": "Roads", "artist": {"name": "Portishead"}}]}}`,
+	"track.getsimilar|Massive Attack|Teardrop": `{"similartracks": {"track": [
+		{"name": "roads", "match": 0.9, "artist": {"name": "PORTISHEAD"}}, {"name": "The Sea", "match": 0.8, "artist": {"name": "Morcheeba"}}]}}`,
+	"track.getsimilar|Portishead|Roads": `{"similartracks": {"track": [{"name": "The Sea", "artist": {"name": "Morcheeba"}}]}}`,
+}
+
+func startFakeLastfm(t *testing.T, responses map[string]string) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("api_key") != "key" || query.Get("format") != "json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		params := []string{query.Get("method"), query.Get("artist"), query.Get("track")}
+		key := strings.Join(slices.DeleteFunc(params, func(param string) bool { return param == "" }), "|")
+		response, ok := responses[key]
+		if !ok {
+			response = `{"error": 6, "message": "not found"}`
+		}
+		_, _ = w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestLastfm(t *testing.T) {
+	tests := []struct {
+		name      string
+		discovery string
+		seeds     int
+		limit     int
+		responses map[string]string
+		want      []models.Track
+		wantErr   string
+	}{
+		{
+			name:      "similar artists",
+			discovery: "artists",
+			seeds:     2,
+			limit:     4,
+			responses: lastfmResponses,
+			want: []models.Track{ // top artists and artists already picked are skipped, tracks without info keep the candidate's fields
+				{RecordingMBID: mbid, ArtistMBID: mbid, ReleaseMBID: mbid, Album: "Maxinquaye", AlbumArtist: "Tricky", Artist: "Tricky", MainArtist: "Tricky", CleanTitle: "Hell Is Round the Corner", Title: "Hell Is Round the Corner", Duration: 228000},
+				{Artist: "Morcheeba", MainArtist: "Morcheeba", CleanTitle: "The Sea", Title: "The Sea"},
+				{RecordingMBID: mbid, Album: "Lives Outgrown", Artist: "Beth Gibbons", MainArtist: "Beth Gibbons", CleanTitle: "Floating on a Moment", Title: "Floating on a Moment"},
+			},
+		},
+		{
+			name:      "limit",
+			discovery: "artists",
+			seeds:     2,
+			limit:     1,
+			responses: lastfmResponses,
+			want: []models.Track{
+				{RecordingMBID: mbid, ArtistMBID: mbid, ReleaseMBID: mbid, Album: "Maxinquaye", AlbumArtist: "Tricky", Artist: "Tricky", MainArtist: "Tricky", CleanTitle: "Hell Is Round the Corner", Title: "Hell Is Round the Corner", Duration: 228000},
+			},
+		},
+		{
+			name:      "similar tracks",
+			discovery: "tracks",
+			seeds:     2,
+			limit:     4,
+			responses: lastfmResponses,
+			want: []models.Track{ // the user's top tracks and tracks already picked are skipped
+				{Artist: "Morcheeba", MainArtist: "Morcheeba", CleanTitle: "The Sea", Title: "The Sea"},
+			},
+		},
+		{
+			name:      "api error",
+			discovery: "artists",
+			seeds:     2,
+			limit:     4,
+			responses: map[string]string{"user.gettopartists": `{"error": 10, "message": "Invalid API key"}`},
+			wantErr:   "Last.fm API returned error 10: Invalid API key",
+		},
+		{
+			name:      "no recommendations",
+			discovery: "tracks",
+			seeds:     2,
+			limit:     4,
+			responses: map[string]string{"user.gettoptracks": lastfmResponses["user.gettoptracks"]},
+			wantErr:   "no recommendations found for Last.fm user listener",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			discoveryCfg := cfg.DiscoveryConfig{Lastfm: cfg.Lastfm{
+				Discovery: test.discovery,
+				User:      "listener",
+				APIKey:    "key",
+				URL:       startFakeLastfm(t, test.responses),
+				Period:    "3month",
+				Seeds:     test.seeds,
+				Limit:     test.limit,
+			}}
+
+			tracks, err := NewLastfm(discoveryCfg, util.NewHttp(util.HttpClientConfig{Timeout: 5})).QueryTracks()
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("QueryTracks: %s", err.Error())
+			}
+			got := make([]models.Track, 0, len(tracks))
+			for _, track := range tracks {
+				got = append(got, *track)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package discovery
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	cfg "explo/src/config"
+	"explo/src/debug"
+	"explo/src/models"
+	"explo/src/util"
+)
+
+const (
+	musicBrainzURL    = "https://musicbrainz.org/ws/2"
+	similarArtistsURL = "https://labs.api.listenbrainz.org/similar-artists/json"
+	similarAlgorithm  = "session_based_days_7500_session_300_contribution_5_threshold_10_limit_100_filter_True_skip_30"
+	userAgent         = "Explo ( https://github.com/LumePart/Explo )"
+)
+
+// ArtistLister returns the most played artists of the music system
+type ArtistLister interface {
+	TopArtists(int) ([]string, error)
+}
+
+type MBArtistSearch struct {
+	Artists []struct {
+		ID    string `json:"id"`
+		Name  string `json:"name"`
+		Score int    `json:"score"`
+	} `json:"artists"`
+}
+
+type SimilarArtists []struct {
+	ArtistMbid string `json:"artist_mbid"`
+	Name       string `json:"name"`
+	Score      int    `json:"score"`
+}
+
+type PopularRecordings []struct {
+	ArtistName    string `json:"artist_name"`
+	RecordingMbid string `json:"recording_mbid"`
+	RecordingName string `json:"recording_name"`
+	TotalListens  int    `json:"total_listen_count"`
+}
+
+type Library struct {
+	HttpClient *util.HttpClient
+	cfg        cfg.Library
+	lb         *ListenBrainz
+	artists    ArtistLister
+	lastMBCall time.Time
+}
+
+func NewLibrary(cfg cfg.DiscoveryConfig, httpClient *util.HttpClient, artists ArtistLister) *Library {
+	return &Library{
+		cfg:        cfg.Library,
+		HttpClient: httpClient,
+		lb:         NewListenBrainz(cfg, httpClient),
+		artists:    artists,
+	}
+}
+
+func (c *Library) QueryTracks() ([]*models.Track, error) { // Recommend popular recordings of artists similar to the library's top artists
+	if c.artists == nil {
+		return nil, fmt.Errorf("no music system to get seed artists from")
+	}
+
+	seeds, err := c.artists.TopArtists(c.cfg.Seeds)
+	if err != nil {
+		return nil, err
+	}
+	if len(seeds) == 0 {
+		return nil, fmt.Errorf("no played artists found in the music system")
+	}
+	debug.Debug(fmt.Sprintf("[library] seed artists: %v", seeds))
+
+	known := make(map[string]bool, len(seeds))
+	for _, seed := range seeds {
+		known[util.Normalize(seed)] = true
+	}
+
+	var mbids []string
+	for _, seed := range seeds {
+		seedMBID, err := c.lookupArtist(seed)
+		if err != nil {
+			debug.Debug(err.Error())
+			continue
+		}
+
+		similar, err := c.getSimilarArtists(seedMBID)
+		if err != nil {
+			log.Printf("[library] %s", err.Error())
+			continue
+		}
+
+		picked := 0
+		for _, artist := range similar {
+			if picked >= c.cfg.SimilarArtists {
+				break
+			}
+			if known[util.Normalize(artist.Name)] || known[artist.ArtistMbid] {
+				continue
+			}
+			known[util.Normalize(artist.Name)], known[artist.ArtistMbid] = true, true
+
+			recordings, err := c.getPopularRecordings(artist.ArtistMbid)
+			if err != nil || len(recordings) == 0 {
+				debug.Debug(fmt.Sprintf("[library] no popular recordings for %s", artist.Name))
+				continue
+			}
+
+			for _, recording := range recordings[:min(c.cfg.TracksPerArtist, len(recordings))] {
+				mbids = append(mbids, recording.RecordingMbid)
+			}
+			picked++
+		}
+	}
+
+	if len(mbids) == 0 {
+		return nil, fmt.Errorf("no recommendations found for library artists")
+	}
+	return c.lb.getTracks(mbids, c.lb.cfg.SingleArtist)
+}
+
+func (c *Library) lookupArtist(name string) (string, error) { // Get artist MBID from MusicBrainz
+	if wait := time.Second - time.Since(c.lastMBCall); wait > 0 { // MusicBrainz allows 1 request per second
+		time.Sleep(wait)
+	}
+	c.lastMBCall = time.Now()
+
+	query := url.QueryEscape(fmt.Sprintf(`artist:"%s"`, name))
+	reqURL := fmt.Sprintf("%s/artist/?query=%s&limit=5&fmt=json", musicBrainzURL, query)
+
+	body, err := c.HttpClient.MakeRequest("GET", reqURL, nil, map[string]string{"User-Agent": userAgent})
+	if err != nil {
+		return "", fmt.Errorf("lookupArtist(): %s", err.Error())
+	}
+
+	var results MBArtistSearch
+	if err = util.ParseResp(body, &results); err != nil {
+		return "", fmt.Errorf("lookupArtist(): %s", err.Error())
+	}
+
+	for _, artist := range results.Artists {
+		if artist.Score >= 90 && util.Normalize(artist.Name) == util.Normalize(name) {
+			return artist.ID, nil
+		}
+	}
+	return "", fmt.Errorf("[library] no MusicBrainz artist found for %s", name)
+}
+
+func (c *Library) getSimilarArtists(mbid string) (SimilarArtists, error) {
+	reqURL := fmt.Sprintf("%s?artist_mbids=%s&algorithm=%s", similarArtistsURL, mbid, similarAlgorithm)
+
+	body, err := c.HttpClient.MakeRequest("GET", reqURL, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("getSimilarArtists(): %s", err.Error())
+	}
+
+	var similar SimilarArtists
+	if err = util.ParseResp(body, &similar); err != nil {
+		return nil, fmt.Errorf("getSimilarArtists(): %s", err.Error())
+	}
+	return similar, nil
+}
+
+func (c *Library) getPopularRecordings(mbid string) (PopularRecordings, error) {
+	body, err := c.lb.lbRequest(fmt.Sprintf("popularity/top-recordings-for-artist/%s", mbid))
+	if err != nil {
+		return nil, fmt.Errorf("getPopularRecordings(): %s", err.Error())
+	}
+
+	var recordings PopularRecordings
+	if err = util.ParseResp(body, &recordings); err != nil {
+		return nil, fmt.Errorf("getPopularRecordings(): %s", err.Error())
+	}
+	return recordings, nil
+}
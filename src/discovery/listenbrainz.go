@@ -2,6 +2,10 @@ package discovery
 
 import (
 	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
@@ -66,39 +70,62 @@ type Playlists struct {
 	} `json:"playlists"`
 }
 
-type Exploration struct {
+type Exploration struct { // JSPF playlist, as returned by ListenBrainz and written by ToJSPF
 	Playlist struct {
-		Annotation string    `json:"annotation"`
+		Annotation string    `json:"annotation,omitempty"`
 		Creator    string    `json:"creator"`
 		Date       time.Time `json:"date"`
-		Identifier string    `json:"identifier"`
+		Identifier string    `json:"identifier,omitempty"`
 		Title      string    `json:"title"`
-		Tracks     []struct {
-			Album      string `json:"album"`
-			Creator    string `json:"creator"`
-			Duration   int `json:"duration"`
-			Extension struct {
-				HTTPSMusicbrainzOrgDocJspfTrack struct {
-					AddedAt            time.Time `json:"added_at"`
-					AddedBy            string    `json:"added_by"`
-					AdditionalMetadata struct {
-						Artists []struct {
-							ArtistCreditName string `json:"artist_credit_name"`
-							ArtistMbid       string `json:"artist_mbid"`
-							JoinPhrase       string `json:"join_phrase"`
-						} `json:"artists"`
-						CaaID          int64  `json:"caa_id"`
-						CaaReleaseMbid string `json:"caa_release_mbid"`
-					} `json:"additional_metadata"`
-					ArtistIdentifiers []string `json:"artist_identifiers"`
-				} `json:"https://musicbrainz.org/doc/jspf#track"`
-			} `json:"extension"`
-			Identifier []string `json:"identifier"`
-			Title      string `json:"title"`
-		} `json:"track"`
+		Tracks     []JSPFTrack `json:"track"`
 	} `json:"playlist"`
 }
 
+type JSPFTrack struct {
+	Album      string `json:"album,omitempty"`
+	Creator    string `json:"creator"`
+	Duration   int `json:"duration,omitempty"`
+	Extension struct {
+		HTTPSMusicbrainzOrgDocJspfTrack struct {
+			AddedAt            *time.Time `json:"added_at,omitempty"`
+			AddedBy            string    `json:"added_by,omitempty"`
+			AdditionalMetadata struct {
+				Artists []struct {
+					ArtistCreditName string `json:"artist_credit_name"`
+					ArtistMbid       string `json:"artist_mbid"`
+					JoinPhrase       string `json:"join_phrase"`
+				} `json:"artists,omitempty"`
+				CaaID          int64  `json:"caa_id,omitempty"`
+				CaaReleaseMbid string `json:"caa_release_mbid,omitempty"`
+			} `json:"additional_metadata"`
+			ArtistIdentifiers []string `json:"artist_identifiers,omitempty"`
+		} `json:"https://musicbrainz.org/doc/jspf#track"`
+	} `json:"extension"`
+	Identifier []string `json:"identifier,omitempty"`
+	Title      string `json:"title"`
+}
+
+type GeneratedPlaylist struct {
+	Title  string // Title prefix used by ListenBrainz
+	Name   string // Base name of the mirrored playlist
+	Period string // How often ListenBrainz generates the playlist: daily, weekly or yearly
+}
+
+var generatedPlaylists = map[string]GeneratedPlaylist{
+	"weekly-exploration":    {Title: "Weekly Exploration", Name: "Weekly-Exploration", Period: "weekly"},
+	"weekly-jams":           {Title: "Weekly Jams", Name: "Weekly-Jams", Period: "weekly"},
+	"daily-jams":            {Title: "Daily Jams", Name: "Daily-Jams", Period: "daily"},
+	"top-discoveries":       {Title: "Top Discoveries of", Name: "Top-Discoveries", Period: "yearly"},
+	"top-missed-recordings": {Title: "Top Missed Recordings of", Name: "Top-Missed-Recordings", Period: "yearly"},
+}
+
+type Radio struct {
+	Payload struct {
+		JSPF     Exploration `json:"jspf"`
+		Feedback []string    `json:"feedback"`
+	} `json:"payload"`
+}
+
 type ListenBrainz struct {
 	HttpClient *util.HttpClient
 	cfg cfg.Listenbrainz
@@ -116,16 +143,29 @@ func (c *ListenBrainz) QueryTracks() ([]*models.Track, error)  {
 	var tracks []*models.Track
 
 	switch c.cfg.Discovery {
-	case "playlist":
-		id, err := c.getWeeklyExploration(c.cfg.User)
+	case "playlist": // Weekly Exploration is blended into the main playlist, other generated playlists are mirrored by QueryPlaylists
+		if !slices.Contains(c.cfg.Playlists, "weekly-exploration") {
+			return nil, nil
+		}
+		id, err := c.getGeneratedPlaylist(c.cfg.User, generatedPlaylists["weekly-exploration"])
 		if err != nil {
 			return nil, err
 		}
-		tracks, err = c.parseWeeklyExploration(id, c.cfg.SingleArtist)
+		tracks, err = c.parsePlaylist(id, c.cfg.SingleArtist)
 		if err != nil {
 			return nil, err
 		}
-		
+
+	case "radio":
+		if c.cfg.RadioPrompt == "" {
+			return nil, fmt.Errorf("LISTENBRAINZ_RADIO_PROMPT is required in radio mode")
+		}
+		var err error
+		tracks, err = c.getRadioTracks(c.cfg.RadioPrompt, c.cfg.SingleArtist)
+		if err != nil {
+			return nil, err
+		}
+
 	default:
 		mbids, err := c.getAPIRecommendations(c.cfg.User)
 		if err != nil {
@@ -139,6 +179,101 @@ func (c *ListenBrainz) QueryTracks() ([]*models.Track, error)  {
 	return tracks, nil
 }
 
+func (c *ListenBrainz) QueryPlaylists() ([]*models.Playlist, error) {
+	playlists := c.getRadioPlaylists()
+	if c.cfg.Discovery != "playlist" {
+		return playlists, nil
+	}
+
+	for _, name := range c.cfg.Playlists {
+		if name == "weekly-exploration" {
+			continue
+		}
+
+		generated, ok := generatedPlaylists[name]
+		if !ok {
+			log.Printf("[listenbrainz] unknown playlist '%s', skipping", name)
+			continue
+		}
+
+		id, err := c.getGeneratedPlaylist(c.cfg.User, generated)
+		if err != nil {
+			log.Printf("[listenbrainz] %s", err.Error())
+			continue
+		}
+
+		tracks, err := c.parsePlaylist(id, c.cfg.SingleArtist)
+		if err != nil {
+			log.Printf("[listenbrainz] %s", err.Error())
+			continue
+		}
+
+		playlists = append(playlists, &models.Playlist{
+			Name:        generated.Name,
+			Description: fmt.Sprintf("Created by Explo from the ListenBrainz %s playlist", strings.TrimSuffix(generated.Title, " of")),
+			Period:      generated.Period,
+			Tracks:      tracks,
+		})
+	}
+	return playlists, nil
+}
+
+func (c *ListenBrainz) getRadioPlaylists() []*models.Playlist { // Create a themed playlist for each configured radio prompt
+	var playlists []*models.Playlist
+
+	for _, entry := range strings.Split(c.cfg.RadioPlaylists, ";") {
+		name, prompt, found := strings.Cut(entry, "=")
+		name, prompt = strings.TrimSpace(name), strings.TrimSpace(prompt)
+		if !found || name == "" || prompt == "" {
+			if strings.TrimSpace(entry) != "" {
+				log.Printf("[listenbrainz] invalid radio playlist '%s', use 'Name=prompt'", entry)
+			}
+			continue
+		}
+
+		tracks, err := c.getRadioTracks(prompt, c.cfg.SingleArtist)
+		if err != nil {
+			log.Printf("[listenbrainz] %s", err.Error())
+			continue
+		}
+
+		playlists = append(playlists, &models.Playlist{
+			Name:        name,
+			Description: fmt.Sprintf("Created by Explo using ListenBrainz Radio prompt: %s", prompt),
+			Tracks:      tracks,
+		})
+	}
+	return playlists
+}
+
+func (c *ListenBrainz) getRadioTracks(prompt string, singleArtist bool) ([]*models.Track, error) { // Generate tracks from a LB Radio prompt
+	body, err := c.lbRequest(fmt.Sprintf("explore/lb-radio?prompt=%s&mode=%s", url.QueryEscape(prompt), c.cfg.RadioMode))
+	if err != nil {
+		return nil, fmt.Errorf("getRadioTracks(): %s", err.Error())
+	}
+
+	var radio Radio
+	if err = util.ParseResp(body, &radio); err != nil {
+		return nil, fmt.Errorf("getRadioTracks(): %s", err.Error())
+	}
+
+	for _, feedback := range radio.Payload.Feedback {
+		debug.Debug(fmt.Sprintf("[listenbrainz] radio feedback for '%s': %s", prompt, feedback))
+	}
+
+	mbids := make([]string, 0, len(radio.Payload.JSPF.Playlist.Tracks))
+	for _, track := range radio.Payload.JSPF.Playlist.Tracks {
+		if mbid := parseMBID(track.Identifier, "recording"); mbid != "" {
+			mbids = append(mbids, mbid)
+		}
+	}
+
+	if len(mbids) == 0 {
+		return nil, fmt.Errorf("no tracks generated for radio prompt '%s'", prompt)
+	}
+	return c.getTracks(mbids, singleArtist)
+}
+
 func (c *ListenBrainz) getAPIRecommendations(user string) ([]string, error) {
 	var mbids []string
 
@@ -181,7 +316,12 @@ func (c *ListenBrainz) getTracks(mbids []string, singleArtist bool) ([]*models.T
 	}
 
 	tracks := make([]*models.Track, 0, len(recordings))
-	for _, recording := range recordings {
+	for _, mbid := range mbids { // keep the order of the given MBIDs
+		recording, ok := recordings[mbid]
+		if !ok {
+			continue
+		}
+
 		title := recording.Recording.Name
 		artist := recording.Artist.Name
 		mainArtist := recording.Artist.Name
@@ -203,8 +343,20 @@ func (c *ListenBrainz) getTracks(mbids []string, singleArtist bool) ([]*models.T
 			}
 		}
 
+		var artistMBID string
+		if len(recording.Artist.Artists) > 0 {
+			artistMBID = recording.Artist.Artists[0].ArtistMbid
+		}
+
 		tracks = append(tracks, &models.Track{
+			RecordingMBID: mbid,
+			ArtistMBID: artistMBID,
+			ReleaseMBID: recording.Release.Mbid,
+			ReleaseGroupMBID: recording.Release.ReleaseGroupMbid,
+			CoverArtMBID: recording.Release.CaaReleaseMbid,
 			Album:       recording.Release.Name,
+			AlbumArtist: recording.Release.AlbumArtistName,
+			Year:        recording.Release.Year,
 			Artist:      artist,
 			MainArtist:  mainArtist,
 			CleanTitle:  recording.Recording.Name,
@@ -217,48 +369,66 @@ func (c *ListenBrainz) getTracks(mbids []string, singleArtist bool) ([]*models.T
 
 }
 
-func (c *ListenBrainz) getWeeklyExploration(user string) (string, error) { // Get user LB playlists and find Weekly Exploration's ID
-	body, err := c.lbRequest(fmt.Sprintf("user/%s/playlists/createdfor", user))
+func (c *ListenBrainz) getGeneratedPlaylist(user string, generated GeneratedPlaylist) (string, error) { // Get user LB playlists and find the newest generated playlist's ID
+	body, err := c.lbRequest(fmt.Sprintf("user/%s/playlists/createdfor?count=100", user))
 	if err != nil {
-		return "", fmt.Errorf("getWeeklyExploration(): %s", err.Error())
+		return "", fmt.Errorf("getGeneratedPlaylist(): %s", err.Error())
 	}
 
 	var playlists Playlists
 	err = util.ParseResp(body, &playlists)
 	if err != nil {
-		return "", fmt.Errorf("getWeeklyExploration(): %s", err.Error())
+		return "", fmt.Errorf("getGeneratedPlaylist(): %s", err.Error())
 	}
 
-	for _, playlist := range playlists.Playlist {
-
-		_, currentWeek := time.Now().Local().ISOWeek()
-		_, creationWeek := playlist.Data.Date.Local().ISOWeek()
+	for _, playlist := range playlists.Playlist { // playlists are sorted newest first
+		if !strings.Contains(playlist.Data.Title, generated.Title) {
+			continue
+		}
 
-		if strings.Contains(playlist.Data.Title, "Weekly Exploration") && currentWeek == creationWeek {
+		if isCurrent(playlist.Data.Date, generated.Period) {
 			id := strings.Split(playlist.Data.Identifier, "/")
 			return id[len(id)-1], nil
 		}
 	}
 	debug.Debug(fmt.Sprintf("playlist output: %v", playlists))
-	return "", fmt.Errorf("failed to get new exploration playlist, check if ListenBrainz has generated one this week")
+	return "", fmt.Errorf("failed to get new %s playlist, check if ListenBrainz has generated one (generated %s)", generated.Title, generated.Period)
+}
+
+func isCurrent(created time.Time, period string) bool { // check if a generated playlist is from the current period
+	now := time.Now().Local()
+	switch period {
+	case "daily":
+		return now.Sub(created) < 24*time.Hour
+	case "weekly":
+		year, currentWeek := now.ISOWeek()
+		creationYear, creationWeek := created.Local().ISOWeek()
+		return year == creationYear && currentWeek == creationWeek
+	default: // yearly playlists are generated once, use the newest one
+		return true
+	}
 }
 
-func (c *ListenBrainz) parseWeeklyExploration(identifier string, singleArtist bool) ([]*models.Track, error) {
+func (c *ListenBrainz) parsePlaylist(identifier string, singleArtist bool) ([]*models.Track, error) {
 	body, err := c.lbRequest(fmt.Sprintf("playlist/%s", identifier))
 	if err != nil {
-		return nil, fmt.Errorf("parseWeeklyExploration(): %s", err.Error())
+		return nil, fmt.Errorf("parsePlaylist(): %s", err.Error())
 	}
 
 	var exploration Exploration
 	err = util.ParseResp(body, &exploration)
 	if err != nil {
-		return nil, fmt.Errorf("parseWeeklyExploration(): %s", err.Error())
+		return nil, fmt.Errorf("parsePlaylist(): %s", err.Error())
 	}
 
 	if len(exploration.Playlist.Tracks) == 0 {
 		return nil, fmt.Errorf("no tracks found in playlist %s", identifier)
 	}
 
+	return parseJSPFTracks(exploration, singleArtist), nil
+}
+
+func parseJSPFTracks(exploration Exploration, singleArtist bool) []*models.Track { // convert JSPF tracks (as returned by LB) to tracks
 	tracks := make([]*models.Track, 0, len(exploration.Playlist.Tracks))
 	for _, track := range exploration.Playlist.Tracks {
 		title := track.Title
@@ -283,6 +453,9 @@ func (c *ListenBrainz) parseWeeklyExploration(identifier string, singleArtist bo
 		}
 
 		tracks = append(tracks, &models.Track{
+			RecordingMBID: parseMBID(track.Identifier, "recording"),
+			ArtistMBID: parseMBID(track.Extension.HTTPSMusicbrainzOrgDocJspfTrack.ArtistIdentifiers, "artist"),
+			CoverArtMBID: track.Extension.HTTPSMusicbrainzOrgDocJspfTrack.AdditionalMetadata.CaaReleaseMbid,
 			Album:      track.Album,
 			MainArtist: mainArtist,
 			Artist:     artist,
@@ -292,8 +465,19 @@ func (c *ListenBrainz) parseWeeklyExploration(identifier string, singleArtist bo
 		})
 	}
 
-	return tracks, nil
+	return tracks
+}
+
+var mbidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
 
+func parseMBID(identifiers []string, entity string) string { // get MBID from MusicBrainz identifier URLs (e.g. https://musicbrainz.org/recording/<mbid>), other identifiers (Spotify, YouTube...) are ignored
+	for _, identifier := range identifiers {
+		path, found := strings.CutPrefix(strings.TrimPrefix(strings.TrimPrefix(identifier, "https://"), "http://"), "musicbrainz.org/"+entity+"/")
+		if id := strings.ToLower(strings.TrimSuffix(path, "/")); found && mbidPattern.MatchString(id) {
+			return id
+		}
+	}
+	return ""
 }
 
 func (c *ListenBrainz) lbRequest(path string) ([]byte, error) { // Handle ListenBrainz API requests
@@ -301,7 +485,12 @@ func (c *ListenBrainz) lbRequest(path string) ([]byte, error) { // Handle Listen
 
 	reqURL := fmt.Sprintf("https://api.listenbrainz.org/1/%s", path)
 	
-	body, err := c.HttpClient.MakeRequest("GET", reqURL, nil, nil)
+	var headers map[string]string
+	if c.cfg.Token != "" {
+		headers = map[string]string{"Authorization": "Token " + c.cfg.Token}
+	}
+
+	body, err := c.HttpClient.MakeRequest("GET", reqURL, nil, headers)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make request to ListenBrainz API: %s", err)
 	}
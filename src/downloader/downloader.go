@@ -1,9 +1,11 @@
 package downloader
 
 import (
+	"context"
 	"os"
 	"path"
 	"log"
+	"slices"
 	"strings"
 	"regexp"
 	"fmt"
@@ -19,12 +21,21 @@ import (
 type DownloadClient struct {
 	Cfg *cfg.DownloadConfig
 	Downloaders []Downloader
+	Tagger *Tagger
 }
 
 type Downloader interface {
 	QueryTrack(*models.Track) error
 	GetTrack(*models.Track) error
-	MonitorDownloads([]*models.Track) error
+	MonitorDownloads(context.Context, []*models.Track) error
+	PreviewTrack(*models.Track) (string, error) // what would be downloaded, without downloading it
+}
+
+type DownloadPreview struct {
+	Track      *models.Track
+	Downloader string // empty if no downloader found the track
+	Source     string
+	Errors     []string
 }
 
 
@@ -43,12 +54,18 @@ func NewDownloader(cfg *cfg.DownloadConfig, httpClient *util.HttpClient) *Downlo
 		}
 	}
 
+	var tagger *Tagger
+	if cfg.Tagging.Enabled {
+		tagger = NewTagger(cfg.Tagging, httpClient)
+	}
+
 	return &DownloadClient{
 		Cfg: cfg,
-		Downloaders: downloader}
+		Downloaders: downloader,
+		Tagger: tagger}
 }
 
-	func (c *DownloadClient) StartDownload(tracks *[]*models.Track) {
+	func (c *DownloadClient) StartDownload(ctx context.Context, tracks *[]*models.Track) { // stops starting new downloads once ctx is cancelled
 		for _, d := range c.Downloaders {
 			var g errgroup.Group
 			g.SetLimit(5)
@@ -59,13 +76,18 @@ func NewDownloader(cfg *cfg.DownloadConfig, httpClient *util.HttpClient) *Downlo
 				}
 					
 				g.Go(func() error {
+					if ctx.Err() != nil {
+						return nil
+					}
 		
 					if err := d.QueryTrack(track); err != nil {
 						log.Println(err.Error())
+						track.FailReason = err.Error()
 						return nil
 					}
 					if err := d.GetTrack(track); err != nil {
 						log.Println(err.Error())
+						track.FailReason = err.Error()
 						return nil
 					}
 					return nil
@@ -75,19 +97,133 @@ func NewDownloader(cfg *cfg.DownloadConfig, httpClient *util.HttpClient) *Downlo
 			return
 		}
 		
-		if err := d.MonitorDownloads(*tracks); err != nil {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := d.MonitorDownloads(ctx, *tracks); err != nil {
 				log.Printf("track monitoring failed: %s", err.Error())
 		}
 	}
+	c.tagTracks(*tracks)
 	filterTracks(tracks)
 }
 
-func (c *DownloadClient) DeleteSongs() {
+func (c *DownloadClient) PreviewDownloads(ctx context.Context, tracks []*models.Track) []DownloadPreview { // find the source of each missing track, in downloader priority order
+	var previews []DownloadPreview
+	for _, track := range tracks {
+		if !track.Present {
+			previews = append(previews, DownloadPreview{Track: track})
+		}
+	}
+
+	var g errgroup.Group
+	g.SetLimit(5)
+	for i := range previews {
+		g.Go(func() error {
+			preview := &previews[i]
+			for _, d := range c.Downloaders {
+				if ctx.Err() != nil {
+					return nil
+				}
+				query := *preview.Track // downloaders set IDs on the track, keep them off the real one
+				source, err := d.PreviewTrack(&query)
+				if err != nil {
+					preview.Errors = append(preview.Errors, err.Error())
+					continue
+				}
+				preview.Downloader, preview.Source = serviceName(d), source
+				return nil
+			}
+			return nil
+		})
+	}
+	_ = g.Wait() // previews don't return errors
+	return previews
+}
+
+func serviceName(d Downloader) string {
+	switch d.(type) {
+	case *Youtube:
+		return "youtube"
+	case *Slskd:
+		return "slskd"
+	}
+	return fmt.Sprintf("%T", d)
+}
+
+func (c *DownloadClient) DownloadTrack(ctx context.Context, track *models.Track) error { // download a single track with the first downloader that succeeds, used for retries
+	for _, d := range c.Downloaders {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := d.QueryTrack(track); err != nil {
+			track.FailReason = err.Error()
+			continue
+		}
+		if err := d.GetTrack(track); err != nil {
+			track.FailReason = err.Error()
+			continue
+		}
+		if err := d.MonitorDownloads(ctx, []*models.Track{track}); err != nil {
+			log.Printf("track monitoring failed: %s", err.Error())
+		}
+
+		if track.Present {
+			c.tagTracks([]*models.Track{track})
+			track.Present = false // clear present status so music system can use the same field
+			track.FailReason = ""
+			return nil
+		}
+	}
+	return fmt.Errorf("couldn't download %s - %s: %s", track.Artist, track.Title, track.FailReason)
+}
+
+func Source(track models.Track) string { // identifies where a downloaded track came from, so it can be rejected
+	switch track.Downloader {
+	case "youtube":
+		return track.DownloadID
+	case "slskd":
+		return sourceKey(track.DownloadUser, track.File)
+	}
+	return ""
+}
+
+func sourceKey(user, file string) string {
+	name, _ := parsePath(file)
+	return user + "|" + name
+}
+
+func (c *DownloadClient) tagTracks(tracks []*models.Track) { // tag tracks downloaded in this run
+	if c.Tagger == nil {
+		return
+	}
+	for _, track := range tracks {
+		if !track.Present || track.Downloader == "" || track.Path == "" {
+			continue
+		}
+		if err := c.Tagger.TagTrack(track); err != nil {
+			log.Printf("[tagger] failed to tag %s: %s", track.File, err.Error())
+		}
+	}
+}
+
+func (c *DownloadClient) DeleteSongs(keep []string) { // delete every download except the paths in keep, which are moved to KEEP_DIR if it's set
 	entries, err := os.ReadDir(c.Cfg.DownloadDir)
 	if err != nil {
 		log.Printf("failed to read directory: %s", err.Error())
 	}
+	var kept int
 	for _, entry := range entries {
+		if !(entry.IsDir()) && slices.Contains(keep, filepath.Join(c.Cfg.DownloadDir, entry.Name())) {
+			kept++
+			if c.Cfg.KeepDir == "" {
+				continue
+			}
+			if err = moveDownload(c.Cfg.DownloadDir, c.Cfg.KeepDir, "", entry.Name()); err != nil {
+				log.Printf("failed to move %s to KEEP_DIR: %s", entry.Name(), err.Error())
+			}
+			continue
+		}
 		if !(entry.IsDir()) {
 			err = os.Remove(path.Join(c.Cfg.DownloadDir, entry.Name()))
 			
@@ -96,6 +232,9 @@ func (c *DownloadClient) DeleteSongs() {
 			}
 		}
 	}
+	if kept > 0 {
+		log.Printf("kept %d liked tracks", kept)
+	}
 }
 
 func filterTracks(tracks *[]*models.Track) { // only keep tracks that were downloaded or were found by music system
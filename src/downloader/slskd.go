@@ -2,6 +2,7 @@ package downloader
 
 import (
 	"bytes" // Could be moved to util for all clients
+	"context"
 	"explo/src/config"
 	"explo/src/debug"
 	"explo/src/models"
@@ -123,7 +124,7 @@ func (c *Slskd) QueryTrack(track *models.Track) error {
 	log.Printf("initiating search for %s", trackDetails)
 
 	defer func() { // Delete search if ID is empty
-		if track.ID == "" {
+		if track.DownloadID == "" {
 			if delErr := c.deleteSearch(ID); delErr != nil {
 				debug.Debug(fmt.Sprintf("[slskd] failed to delete search: %s", delErr.Error()))
 			}
@@ -138,12 +139,12 @@ func (c *Slskd) QueryTrack(track *models.Track) error {
 		return fmt.Errorf("search not completed for %s, skipping track", trackDetails)
 	}
 
-	track.ID = ID
+	track.DownloadID = ID
 	return nil
 }
 
 func (c *Slskd) GetTrack(track *models.Track) error {
-	results, err := c.searchResults(track.ID)
+	results, err := c.searchResults(track.DownloadID)
 	if err != nil {
 		return err
 	}
@@ -161,6 +162,10 @@ func (c *Slskd) GetTrack(track *models.Track) error {
 	return nil
 }
 
+func (c *Slskd) PreviewTrack(track *models.Track) (string, error) { // searches are shared with other peers, so a dry run only reports it
+	return fmt.Sprintf("would search for '%s - %s'", track.CleanTitle, track.Artist), nil
+}
+
 func (c Slskd) searchTrack(track *models.Track) (string, error) {
 	reqParams := "/api/v0/searches"
 
@@ -250,6 +255,10 @@ func (c Slskd) CollectFiles(track models.Track, searchResults SearchResults) ([]
 						continue
 					}
 
+					if slices.Contains(track.Rejected, sourceKey(result.Username, string(file.Name))) {
+						continue
+					}
+
 					sanitizedFilename := sanitizeName(string(file.Name))
 					if (containsLower(sanitizedFilename, sanitizedArtist) || containsLower(sanitizedFilename, sanitizedAlbum)) && containsLower(sanitizedFilename, sanitizedTitle) {
 						file.Username = result.Username
@@ -315,7 +324,7 @@ func (c Slskd) queueDownload(files []File, track *models.Track) error {
 
 		_, err = c.HttpClient.MakeRequest("POST", c.Cfg.URL+reqParams, bytes.NewBuffer(DLpayload), c.Headers)
 		if err == nil {
-			track.MainArtistID = file.Username
+			track.DownloadUser = file.Username
 			track.Size = file.Size
 			track.File = file.Name
 			return nil
@@ -324,7 +333,7 @@ func (c Slskd) queueDownload(files []File, track *models.Track) error {
 		log.Printf("[%d/%d] failed to queue download for '%s - %s': %s", i + 1, len(files), track.CleanTitle, track.Artist, err.Error())
 		continue
 	}
-	if err := c.deleteSearch(track.ID); err != nil {
+	if err := c.deleteSearch(track.DownloadID); err != nil {
 		debug.Debug(fmt.Sprintf("failed to delete search: %s", err.Error()))
 	}
 	return fmt.Errorf("couldn't download track: %s - %s", track.CleanTitle, track.Artist)
@@ -346,7 +355,7 @@ func (c Slskd) getDownloadStatus() (DownloadStatus, error) {
 	return status, nil
 }
 
-func (c *Slskd) MonitorDownloads(tracks []*models.Track) error {
+func (c *Slskd) MonitorDownloads(ctx context.Context, tracks []*models.Track) error {
 	const checkInterval = 1 * time.Minute
 	const monitorDuration = 15 * time.Minute
 	var successDownloads int
@@ -369,9 +378,9 @@ func (c *Slskd) MonitorDownloads(tracks []*models.Track) error {
 
 			for _, track := range tracks {
 
-				key := fmt.Sprintf("%s|%s", track.MainArtistID, track.File)
+				key := fmt.Sprintf("%s|%s", track.DownloadUser, track.File)
 
-				if track.Present || track.MainArtistID == "" || (progressMap[key] != nil && progressMap[key].Skipped)  {
+				if track.Present || track.DownloadUser == "" || (progressMap[key] != nil && progressMap[key].Skipped)  {
 					continue
 				}
 
@@ -394,18 +403,22 @@ func (c *Slskd) MonitorDownloads(tracks []*models.Track) error {
 					if tracker.Counter >= 2 {
 						log.Printf("[slskd] %s by %s not found in queue after retries, skipping track", track.CleanTitle, track.MainArtist)
 						tracker.Skipped = true
+						track.FailReason = "not found in slskd download queue"
 					}
 					continue
 				}
 
 				if fileStatus.BytesRemaining == 0 || fileStatus.PercentComplete == 100 || strings.Contains(fileStatus.State, "Succeeded") {
 					track.Present = true
+					track.Downloader = "slskd"
 					log.Printf("[slskd] %s downloaded successfully", track.File)
 					file, path := parsePath(track.File)
+					track.Path = filepath.Join(c.Cfg.SlskdDir, path, file)
 					if c.Cfg.MigrateDL {
 						if err = moveDownload(c.Cfg.SlskdDir, c.DownloadDir, path, file); err != nil {
 							debug.Debug(err.Error())
 						} else {
+							track.Path = filepath.Join(c.DownloadDir, path, file)
 							debug.Debug("track moved successfully")
 						}
 					}
@@ -424,6 +437,7 @@ func (c *Slskd) MonitorDownloads(tracks []*models.Track) error {
 				} else if currentTime.Sub(tracker.LastUpdated) > monitorDuration || strings.Contains(fileStatus.State, "Errored") || strings.Contains(fileStatus.State, "Cancelled") {
 					log.Printf("[slskd] no progress on %s in %v, skipping track", track.File, monitorDuration)
 					tracker.Skipped = true
+					track.FailReason = fmt.Sprintf("slskd download stalled (%s)", fileStatus.State)
 					c.cleanupTrack(track, fileStatus.ID)
 					continue
 				}
@@ -434,15 +448,16 @@ func (c *Slskd) MonitorDownloads(tracks []*models.Track) error {
 				log.Printf("[slskd] %d out of %d tracks have been downloaded", successDownloads, len(tracks))
 				return nil
 			}
-		default:
-			continue
+		case <-ctx.Done():
+			log.Printf("[slskd] monitoring stopped, %d out of %d tracks have been downloaded", successDownloads, len(tracks))
+			return ctx.Err()
 		}
 	}
 }
 
 func (c Slskd) findFile(status DownloadStatus, track models.Track) DownloadFiles {
 	for _, userStatus := range status {
-		if userStatus.Username != track.MainArtistID {
+		if userStatus.Username != track.DownloadUser {
 			continue
 		}
 		for _, dir := range userStatus.Directories {
@@ -458,7 +473,7 @@ func (c Slskd) findFile(status DownloadStatus, track models.Track) DownloadFiles
 
 func (c Slskd) tracksProcessed(tracks []*models.Track, progressMap map[string]*DownloadMonitor) bool { // Checks if all tracks are processed (either downloaded or skipped)
 	for _, track := range tracks {
-		key := fmt.Sprintf("%s|%s", track.MainArtistID, track.File)
+		key := fmt.Sprintf("%s|%s", track.DownloadUser, track.File)
 		tracker, exists := progressMap[key]
 		if !track.Present && exists && !tracker.Skipped {
 			log.Printf("%s still present", track.File)
@@ -485,10 +500,10 @@ func (c Slskd) deleteDownload(user, ID string) error {
 }
 
 func (c *Slskd) cleanupTrack(track *models.Track, fileID string) {
-    if err := c.deleteSearch(track.ID); err != nil {
+    if err := c.deleteSearch(track.DownloadID); err != nil {
         debug.Debug(fmt.Sprintf("[slskd] failed to delete search request: %v", err))
     }
-    if err := c.deleteDownload(track.MainArtistID, fileID); err != nil {
+    if err := c.deleteDownload(track.DownloadUser, fileID); err != nil {
        	debug.Debug(fmt.Sprintf("[slskd] failed to delete download: %v", err))
     }
 }
@@ -0,0 +1,263 @@
+package downloader
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cfg "explo/src/config"
+	"explo/src/debug"
+	"explo/src/models"
+	"explo/src/util"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+const (
+	musicBrainzURL = "https://musicbrainz.org/ws/2"
+	coverArtURL    = "https://coverartarchive.org/release"
+	userAgent      = "Explo ( https://github.com/LumePart/Explo )"
+)
+
+type MBRelease struct {
+	Date  string `json:"date"`
+	Media []struct {
+		Position int `json:"position"`
+		Tracks   []struct {
+			Position  int `json:"position"`
+			Recording struct {
+				ID string `json:"id"`
+			} `json:"recording"`
+		} `json:"tracks"`
+	} `json:"media"`
+}
+
+type Tagger struct {
+	HttpClient *util.HttpClient
+	Cfg        cfg.Tagging
+	mbMu       sync.Mutex
+	lastMBCall time.Time
+}
+
+func NewTagger(cfg cfg.Tagging, httpClient *util.HttpClient) *Tagger {
+	return &Tagger{
+		Cfg:        cfg,
+		HttpClient: httpClient,
+	}
+}
+
+func (t *Tagger) TagTrack(track *models.Track) error { // write MusicBrainz tags and cover art to a downloaded file
+	ext := strings.ToLower(filepath.Ext(track.Path))
+	switch ext {
+	case ".opus", ".ogg", ".flac", ".mp3", ".m4a":
+	default:
+		return fmt.Errorf("unsupported format: %s", ext)
+	}
+
+	if t.Cfg.TrackNumbers {
+		if err := t.lookupRelease(track); err != nil {
+			debug.Debug(fmt.Sprintf("[tagger] %s", err.Error()))
+		}
+	}
+
+	var cover []byte
+	if t.Cfg.CoverArt && track.CoverArtMBID != "" {
+		var err error
+		if cover, err = t.getCoverArt(track.CoverArtMBID, ext); err != nil {
+			debug.Debug(fmt.Sprintf("[tagger] %s", err.Error()))
+		}
+	}
+
+	output := strings.TrimSuffix(track.Path, filepath.Ext(track.Path)) + ".tagging" + ext
+	if err := t.writeTags(*track, ext, cover, output); err != nil {
+		if rmErr := os.Remove(output); rmErr != nil && !os.IsNotExist(rmErr) {
+			debug.Debug(fmt.Sprintf("failed to remove %s: %s", output, rmErr.Error()))
+		}
+		return err
+	}
+
+	if err := os.Rename(output, track.Path); err != nil {
+		return fmt.Errorf("failed to replace file: %s", err.Error())
+	}
+	debug.Debug(fmt.Sprintf("[tagger] tagged %s", track.Path))
+	return nil
+}
+
+func (t *Tagger) writeTags(track models.Track, ext string, cover []byte, output string) error {
+	input := ffmpeg.Input(track.Path)
+	streams := []*ffmpeg.Stream{input.Audio()}
+	args := ffmpeg.KwArgs{
+		"c":        "copy",
+		"metadata": trackMetadata(track, ext),
+		"loglevel": "error",
+	}
+
+	switch ext {
+	case ".opus", ".ogg": // Ogg can't hold picture streams, cover is embedded as a Vorbis comment
+		if cover != nil {
+			args["metadata"] = append(args["metadata"].([]string), "METADATA_BLOCK_PICTURE="+pictureBlock(cover))
+		}
+	default:
+		if cover != nil {
+			coverFile, err := os.CreateTemp("", "explo-cover-*.jpg")
+			if err != nil {
+				return fmt.Errorf("failed to create cover file: %s", err.Error())
+			}
+			defer func() {
+				if err := os.Remove(coverFile.Name()); err != nil {
+					debug.Debug(fmt.Sprintf("failed to remove %s: %s", coverFile.Name(), err.Error()))
+				}
+			}()
+			if _, err = coverFile.Write(cover); err != nil {
+				return fmt.Errorf("failed to write cover file: %s", err.Error())
+			}
+			if err = coverFile.Close(); err != nil {
+				return fmt.Errorf("failed to write cover file: %s", err.Error())
+			}
+
+			streams = append(streams, ffmpeg.Input(coverFile.Name()).Video())
+			args["disposition:v:0"] = "attached_pic"
+		}
+		if ext == ".mp3" {
+			args["id3v2_version"] = "3"
+		}
+		if ext == ".m4a" {
+			args["movflags"] = "use_metadata_tags"
+		}
+	}
+
+	cmd := ffmpeg.Output(streams, output, args).OverWriteOutput().ErrorToStdOut()
+	if t.Cfg.FfmpegPath != "" {
+		cmd.SetFfmpegPath(t.Cfg.FfmpegPath)
+	}
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %s", err.Error())
+	}
+	return nil
+}
+
+func (t *Tagger) lookupRelease(track *models.Track) error { // get track number and year from the MusicBrainz release
+	releaseMBID := track.ReleaseMBID
+	if releaseMBID == "" {
+		releaseMBID = track.CoverArtMBID
+	}
+	if releaseMBID == "" || track.RecordingMBID == "" || track.TrackNumber != 0 {
+		return nil
+	}
+
+	t.mbMu.Lock()
+	if wait := time.Second - time.Since(t.lastMBCall); wait > 0 { // MusicBrainz allows 1 request per second
+		time.Sleep(wait)
+	}
+	t.lastMBCall = time.Now()
+	t.mbMu.Unlock()
+
+	reqURL := fmt.Sprintf("%s/release/%s?inc=recordings&fmt=json", musicBrainzURL, releaseMBID)
+	body, err := t.HttpClient.MakeRequest("GET", reqURL, nil, map[string]string{"User-Agent": userAgent})
+	if err != nil {
+		return fmt.Errorf("lookupRelease(): %s", err.Error())
+	}
+
+	var release MBRelease
+	if err = util.ParseResp(body, &release); err != nil {
+		return fmt.Errorf("lookupRelease(): %s", err.Error())
+	}
+
+	if track.Year == 0 && len(release.Date) >= 4 {
+		if year, err := strconv.Atoi(release.Date[:4]); err == nil {
+			track.Year = year
+		}
+	}
+
+	for _, medium := range release.Media {
+		for _, releaseTrack := range medium.Tracks {
+			if releaseTrack.Recording.ID == track.RecordingMBID {
+				track.TrackNumber = releaseTrack.Position
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("recording %s not found on release %s", track.RecordingMBID, releaseMBID)
+}
+
+func (t *Tagger) getCoverArt(mbid, ext string) ([]byte, error) { // get front cover from the Cover Art Archive
+	size := "500"
+	if ext == ".opus" || ext == ".ogg" {
+		size = "250" // cover is passed as a command line argument, keep it small
+	}
+
+	resp, err := t.HttpClient.Client.Get(fmt.Sprintf("%s/%s/front-%s", coverArtURL, mbid, size))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cover art: %s", err.Error())
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("warning: response body close failed: %v", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("no cover art found for release %s (%d)", mbid, resp.StatusCode)
+	}
+
+	var buf bytes.Buffer
+	if _, err = buf.ReadFrom(resp.Body); err != nil {
+		return nil, fmt.Errorf("failed to read cover art: %s", err.Error())
+	}
+	return buf.Bytes(), nil
+}
+
+func trackMetadata(track models.Track, ext string) []string { // ffmpeg metadata, MusicBrainz tags use the names Picard writes for each format
+	metadata := []string{"artist=" + track.Artist, "title=" + track.Title, "album=" + track.Album}
+	if track.AlbumArtist != "" {
+		metadata = append(metadata, "album_artist="+track.AlbumArtist)
+	}
+	if track.Year != 0 {
+		metadata = append(metadata, fmt.Sprintf("date=%d", track.Year))
+	}
+	if track.TrackNumber != 0 {
+		metadata = append(metadata, fmt.Sprintf("track=%d", track.TrackNumber))
+	}
+
+	tags := []string{"MUSICBRAINZ_TRACKID", "MUSICBRAINZ_ARTISTID", "MUSICBRAINZ_ALBUMID", "MUSICBRAINZ_RELEASEGROUPID"}
+	if ext == ".mp3" || ext == ".m4a" {
+		tags = []string{"MusicBrainz Track Id", "MusicBrainz Artist Id", "MusicBrainz Album Id", "MusicBrainz Release Group Id"}
+	}
+
+	for i, mbid := range []string{track.RecordingMBID, track.ArtistMBID, track.ReleaseMBID, track.ReleaseGroupMBID} {
+		if mbid != "" {
+			metadata = append(metadata, tags[i]+"="+mbid)
+		}
+	}
+	return metadata
+}
+
+func pictureBlock(image []byte) string { // FLAC picture block with a front cover, as used by METADATA_BLOCK_PICTURE
+	mime := http.DetectContentType(image)
+
+	var block bytes.Buffer
+	write := func(v uint32) { _ = binary.Write(&block, binary.BigEndian, v) }
+
+	write(3) // front cover
+	write(uint32(len(mime)))
+	block.WriteString(mime)
+	write(0) // description length
+	write(0) // width
+	write(0) // height
+	write(0) // color depth
+	write(0) // indexed colors
+	write(uint32(len(image)))
+	block.Write(image)
+
+	return base64.StdEncoding.EncodeToString(block.Bytes())
+}
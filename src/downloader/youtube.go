@@ -7,6 +7,7 @@ import (
 	"log"
 	"net/url"
 	"os"
+	"slices"
 	"strings"
 
 	cfg "explo/src/config"
@@ -67,7 +68,7 @@ func (c *Youtube) QueryTrack(track *models.Track) error { // Queries youtube for
 	if id == "" {
 		return fmt.Errorf("no YouTube video found for track: %s - %s", track.Title, track.Artist)
 	}
-	track.ID = id
+	track.DownloadID = id
 
 	return nil
 }
@@ -79,13 +80,22 @@ func (c *Youtube) GetTrack(track *models.Track) error {
 	track.Present = fetchAndSaveVideo(ctx, *c, *track)
 
 	if track.Present {
+		track.Downloader = "youtube"
+		track.Path = c.DownloadDir + track.File
 		log.Printf("[youtube] Download finished: %s - %s", track.Artist, track.Title)
 		return nil
 	}
 	return fmt.Errorf("failed to download track: %s - %s", track.Title, track.Artist)
 }
 
-func (c *Youtube) MonitorDownloads(track []*models.Track) error { // No need to monitor yt-dlp downloads, there is no queue for them
+func (c *Youtube) PreviewTrack(track *models.Track) (string, error) {
+	if err := c.QueryTrack(track); err != nil {
+		return "", err
+	}
+	return "https://www.youtube.com/watch?v=" + track.DownloadID, nil
+}
+
+func (c *Youtube) MonitorDownloads(ctx context.Context, track []*models.Track) error { // No need to monitor yt-dlp downloads, there is no queue for them
 	log.Println("[youtube] No further monitoring required")
 	return nil
  }
@@ -93,6 +103,9 @@ func (c *Youtube) MonitorDownloads(track []*models.Track) error { // No need to
 func getTopic(cfg cfg.Youtube, videos Videos, track models.Track) string { // gets song under artist topic or personal channel
 
 	for _, v := range videos.Items {
+		if slices.Contains(track.Rejected, v.ID.VideoID) {
+			continue
+		}
 		if (strings.Contains(v.Snippet.ChannelTitle, "- Topic") || v.Snippet.ChannelTitle == track.MainArtist) && filter(track, v.Snippet.Title, cfg.Filters.FilterList) {
 			return v.ID.VideoID
 		}
@@ -150,7 +163,7 @@ func saveVideo(c Youtube, track models.Track, stream *goutubedl.DownloadResult)
 
 	cmd := ffmpeg.Input(input).Output(fmt.Sprintf("%s%s", c.DownloadDir, track.File), ffmpeg.KwArgs{
 		"map":      "0:a",
-		"metadata": []string{"artist=" + track.Artist, "title=" + track.Title, "album=" + track.Album},
+		"metadata": trackMetadata(track, ".opus"),
 		"loglevel": "error",
 	}).OverWriteOutput().ErrorToStdOut()
 
@@ -180,7 +193,7 @@ func gatherVideo(cfg cfg.Youtube, videos Videos, track models.Track) string { //
 	}
 	// If official video isn't found, try the first suitable channel
 	for _, video := range videos.Items {
-		if filter(track, video.Snippet.Title, cfg.Filters.FilterList) {
+		if !slices.Contains(track.Rejected, video.ID.VideoID) && filter(track, video.Snippet.Title, cfg.Filters.FilterList) {
 			return video.ID.VideoID
 		}
 	}
@@ -189,9 +202,9 @@ func gatherVideo(cfg cfg.Youtube, videos Videos, track models.Track) string { //
 }
 
 func fetchAndSaveVideo(ctx context.Context, cfg Youtube, track models.Track) bool {
-	stream, err := getVideo(ctx, cfg, track.ID)
+	stream, err := getVideo(ctx, cfg, track.DownloadID)
 	if err != nil {
-		log.Printf("failed getting stream for video ID %s: %s", track.ID, err.Error())
+		log.Printf("failed getting stream for video ID %s: %s", track.DownloadID, err.Error())
 		return false
 	}
 
@@ -199,7 +212,7 @@ func fetchAndSaveVideo(ctx context.Context, cfg Youtube, track models.Track) boo
 		return saveVideo(cfg, track, stream)
 	}
 
-	log.Printf("stream was nil for video ID %s", track.ID)
+	log.Printf("stream was nil for video ID %s", track.DownloadID)
 	return false
 }
 
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+
+	"explo/src/client"
+	"explo/src/config"
+	"explo/src/discovery"
+	"explo/src/downloader"
+	"explo/src/models"
+
+	"github.com/robfig/cron/v3"
+)
+
+const usage = `Usage: explo [command] [flags]
+
+Commands:
+  run [-dry-run] [-once]                     discover, download and create playlists (default)
+  discover [-format json|jspf] [-playlist name] [-o file]
+                                             print discovered tracks
+  download <file>                            download tracks of a JSPF, XSPF, M3U or CSV file
+  playlist create [-description text] <name> <file>
+                                             create a playlist from tracks of a file found in the music system
+  playlist delete <name>                     delete a playlist from the music system
+  library check <file>                       check which tracks of a file are in the music system
+  config validate                            check the configuration and the connection to the music system
+
+Run 'explo <command> -h' for the flags of a command.
+`
+
+func runCommand(cfg *config.Config, args []string) error {
+	switch args[0] {
+	case "run":
+		return cmdRun(cfg, args[1:])
+	case "discover":
+		return cmdDiscover(cfg, args[1:])
+	case "download":
+		return cmdDownload(cfg, args[1:])
+	case "playlist":
+		return cmdPlaylist(cfg, args[1:])
+	case "library":
+		return cmdLibrary(cfg, args[1:])
+	case "config":
+		return cmdConfig(cfg, args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command '%s'", args[0])
+	}
+}
+
+func cmdRun(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", cfg.DryRun, "report what would happen, without downloading or changing playlists")
+	once := flags.Bool("once", false, "run once even if SCHEDULE or HTTP_ADDR is set")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg.DryRun = *dryRun
+	if *once {
+		cfg.Schedule, cfg.ServerCfg.Address = "", ""
+	}
+	return run(cfg)
+}
+
+func cmdDiscover(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("discover", flag.ExitOnError)
+	format := flags.String("format", "json", "output format: json or jspf")
+	name := flags.String("playlist", "", "only print the playlist with this name (jspf prints the first playlist by default)")
+	output := flags.String("o", "", "write to file instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *format != "json" && *format != "jspf" {
+		return fmt.Errorf("unknown format '%s', use json or jspf", *format)
+	}
+
+	httpClient := initHttpClient()
+	var artists discovery.ArtistLister
+	if slices.Contains(cfg.DiscoveryCfg.Discovery, "library") && len(cfg.SystemNames()) > 0 { // only the library service needs a music system, the first one like in a run
+		systemCfg, err := cfg.ForSystem(cfg.SystemNames()[0])
+		if err != nil {
+			return err
+		}
+		c, err := client.NewClient(systemCfg, httpClient)
+		if err != nil {
+			return err
+		}
+		artists = c
+	}
+
+	discoverer, err := discovery.NewDiscoverer(cfg.DiscoveryCfg, httpClient, artists)
+	if err != nil {
+		return err
+	}
+	playlists, err := discoverer.Discover()
+	if err != nil {
+		return err
+	}
+	for _, playlist := range playlists {
+		playlist.Name = cfg.GetPlaylistName(playlist.Name, playlist.Period)
+	}
+
+	if *name != "" {
+		i := slices.IndexFunc(playlists, func(p *models.Playlist) bool { return p.Name == *name })
+		if i < 0 {
+			return fmt.Errorf("no playlist named %s was discovered", *name)
+		}
+		playlists = playlists[i : i+1]
+	}
+
+	if len(playlists) == 0 {
+		return errors.New("no playlists were discovered")
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %s", *output, err.Error())
+		}
+		defer closeFile(f)
+		out = f
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if *format == "jspf" {
+		return encoder.Encode(discovery.ToJSPF(playlists[0]))
+	}
+	return encoder.Encode(playlists)
+}
+
+func cmdDownload(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("download", flag.ExitOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: explo download <file>")
+	}
+
+	tracks, err := discovery.ParseFile(flags.Arg(0), cfg.DiscoveryCfg.Listenbrainz.SingleArtist)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	downloaded := slices.Clone(tracks)
+	downloader.NewDownloader(&cfg.DownloadCfg, initHttpClient()).StartDownload(ctx, &downloaded)
+
+	for _, track := range tracks {
+		if track.Downloader != "" {
+			fmt.Printf("[%s] %s - %s: %s\n", track.Downloader, track.Artist, track.Title, track.Path)
+		} else {
+			fmt.Printf("[failed] %s - %s: %s\n", track.Artist, track.Title, track.FailReason)
+		}
+	}
+	fmt.Printf("%d of %d tracks downloaded\n", len(downloaded), len(tracks))
+	return nil
+}
+
+func cmdPlaylist(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: explo playlist create|delete")
+	}
+
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("playlist create", flag.ExitOnError)
+		description := flags.String("description", "Created by Explo", "playlist description")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() != 2 {
+			return errors.New("usage: explo playlist create [-description text] <name> <file>")
+		}
+
+		c, tracks, err := checkFile(cfg, flags.Arg(1))
+		if err != nil {
+			return err
+		}
+		var found []*models.Track
+		for _, track := range tracks {
+			if track.Present {
+				found = append(found, track)
+			}
+		}
+		if len(found) == 0 {
+			return fmt.Errorf("none of the tracks in %s were found in %s", flags.Arg(1), c.System)
+		}
+
+		c.SetPlaylist(flags.Arg(0))
+		if err := c.CreatePlaylist(found, *description); err != nil {
+			return err
+		}
+		fmt.Printf("created %s with %d of %d tracks\n", flags.Arg(0), len(found), len(tracks))
+		return nil
+
+	case "delete":
+		if len(args) != 2 {
+			return errors.New("usage: explo playlist delete <name>")
+		}
+		c, err := newClient(cfg)
+		if err != nil {
+			return err
+		}
+		c.SetPlaylist(args[1])
+		if err := c.DeletePlaylist(); err != nil {
+			return err
+		}
+		fmt.Printf("deleted %s\n", args[1])
+		return nil
+
+	default:
+		return fmt.Errorf("unknown playlist command '%s', use create or delete", args[0])
+	}
+}
+
+func cmdLibrary(cfg *config.Config, args []string) error {
+	if len(args) != 2 || args[0] != "check" {
+		return errors.New("usage: explo library check <file>")
+	}
+
+	c, tracks, err := checkFile(cfg, args[1])
+	if err != nil {
+		return err
+	}
+
+	var found int
+	for _, track := range tracks {
+		if track.Present {
+			found++
+			fmt.Printf("[present] %s - %s\n", track.Artist, track.Title)
+		} else {
+			fmt.Printf("[missing] %s - %s\n", track.Artist, track.Title)
+		}
+	}
+	fmt.Printf("%d of %d tracks found in %s\n", found, len(tracks), c.System)
+	return nil
+}
+
+func cmdConfig(cfg *config.Config, args []string) error {
+	if len(args) != 1 || args[0] != "validate" {
+		return errors.New("usage: explo config validate")
+	}
+
+	err := cfg.Validate()
+	if cfg.Schedule != "" {
+		if _, cronErr := cron.ParseStandard(cfg.Schedule); cronErr != nil {
+			err = errors.Join(err, fmt.Errorf("SCHEDULE: %s", cronErr.Error()))
+		}
+	}
+	for _, name := range cfg.SystemNames() {
+		systemCfg, cfgErr := cfg.ForSystem(name)
+		if !slices.Contains(config.Systems, name) || cfgErr != nil { // already reported
+			continue
+		}
+		if _, clientErr := client.NewClient(systemCfg, initHttpClient()); clientErr != nil {
+			err = errors.Join(err, fmt.Errorf("%s: %s", name, clientErr.Error()))
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("config is not valid:\n%s", err.Error())
+	}
+	fmt.Println("config is valid")
+	return nil
+}
+
+func checkFile(cfg *config.Config, path string) (*client.Client, []*models.Track, error) { // read tracks from a file and look them up in the music system
+	tracks, err := discovery.ParseFile(path, cfg.DiscoveryCfg.Listenbrainz.SingleArtist)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := newClient(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.CheckTracks(tracks)
+	return c, tracks, nil
+}
+
+func newClient(cfg *config.Config) (*client.Client, error) { // commands that change a single system
+	systems := cfg.SystemNames()
+	if len(systems) != 1 {
+		return nil, fmt.Errorf("EXPLO_SYSTEM lists %d systems, set it to one of them for this command", len(systems))
+	}
+	systemCfg, err := cfg.ForSystem(systems[0])
+	if err != nil {
+		return nil, err
+	}
+	return client.NewClient(systemCfg, initHttpClient())
+}
+
+func closeFile(f *os.File) {
+	if err := f.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to close %s: %s\n", f.Name(), err.Error())
+	}
+}
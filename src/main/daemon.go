@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"explo/src/app"
+	"explo/src/config"
+	"explo/src/debug"
+	"explo/src/server"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Daemon explores on a cron schedule and serves the HTTP API until it receives SIGINT or SIGTERM, SIGUSR1 starts a run immediately
+type Daemon struct {
+	cfg       *config.Config
+	app       *app.App
+	scheduler *cron.Cron
+}
+
+func NewDaemon(cfg *config.Config, explorer *app.App) *Daemon {
+	return &Daemon{
+		cfg:       cfg,
+		app:       explorer,
+		scheduler: cron.New(),
+	}
+}
+
+func (d *Daemon) Start() error {
+	if err := d.cfg.ServerCfg.CheckAuth(); err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if d.cfg.Schedule != "" {
+		if _, err := d.scheduler.AddFunc(d.cfg.Schedule, func() { d.RunNow(ctx, "scheduled") }); err != nil {
+			return fmt.Errorf("invalid SCHEDULE '%s': %s", d.cfg.Schedule, err.Error())
+		}
+		d.scheduler.Start()
+		log.Printf("[daemon] started with schedule '%s', next run at %s", d.cfg.Schedule, d.nextRun())
+	}
+
+	var srv *server.Server
+	if d.cfg.ServerCfg.Address != "" {
+		srv = server.NewServer(d.cfg.ServerCfg, d.app)
+		go func() {
+			if err := srv.ListenAndServe(); err != nil {
+				log.Printf("[server] %s", err.Error())
+				stop()
+			}
+		}()
+	}
+
+	trigger := make(chan os.Signal, 1)
+	signal.Notify(trigger, syscall.SIGUSR1)
+	defer signal.Stop(trigger)
+
+	if d.cfg.RunOnStart {
+		go d.RunNow(ctx, "startup")
+	}
+
+	for {
+		select {
+		case <-trigger:
+			go d.RunNow(ctx, "SIGUSR1")
+		case <-ctx.Done():
+			log.Println("[daemon] shutting down, waiting for the current run to stop")
+			<-d.scheduler.Stop().Done()
+			if srv != nil {
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				if err := srv.Shutdown(shutdownCtx); err != nil {
+					log.Printf("[server] shutdown failed: %s", err.Error())
+				}
+			}
+			d.app.Cancel()
+			d.app.Wait()
+			return nil
+		}
+	}
+}
+
+func (d *Daemon) RunNow(ctx context.Context, reason string) bool { // explore unless a run is already in progress, returns false if skipped
+	if ctx.Err() != nil {
+		return false
+	}
+	if _, running := d.app.Current(); !running {
+		d.updateYtdlp(ctx)
+	}
+
+	err := d.app.Run(ctx)
+	if errors.Is(err, app.ErrRunning) {
+		log.Printf("[daemon] skipping %s run, previous run is still in progress", reason)
+		return false
+	}
+	if err != nil {
+		log.Printf("[daemon] run failed: %s", err.Error())
+	}
+	if d.cfg.Schedule != "" {
+		log.Printf("[daemon] next run at %s", d.nextRun())
+	}
+	return true
+}
+
+func (d *Daemon) updateYtdlp(ctx context.Context) { // YouTube breaks old yt-dlp versions, a failed update still runs with the installed one
+	if d.cfg.YtdlpUpdate == "" {
+		return
+	}
+	output, err := exec.CommandContext(ctx, "sh", "-c", d.cfg.YtdlpUpdate).CombinedOutput()
+	if err != nil {
+		log.Printf("[daemon] YTDLP_UPDATE failed: %s: %s", err.Error(), strings.TrimSpace(string(output)))
+		return
+	}
+	debug.Debug(fmt.Sprintf("[daemon] YTDLP_UPDATE output: %s", output))
+}
+
+func (d *Daemon) nextRun() string {
+	entries := d.scheduler.Entries()
+	if len(entries) == 0 {
+		return "never"
+	}
+	return entries[0].Next.Format("2006-01-02 15:04 MST")
+}
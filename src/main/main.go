@@ -1,13 +1,15 @@
 package main
 
 import (
+	"context"
 	"explo/src/debug"
+	"fmt"
 	"log"
+	"os"
 
-	"explo/src/client"
+	"explo/src/app"
 	"explo/src/config"
-	"explo/src/discovery"
-	"explo/src/downloader"
+	"explo/src/store"
 	"explo/src/util"
 )
 
@@ -23,43 +25,46 @@ func initHttpClient() *util.HttpClient {
 	})
 }
 
-func setup(cfg *config.Config) { // Inits debug, gets playlist name, if needed, handles deprecation
+func setup(cfg *config.Config) { // Inits debug, if needed, handles deprecation
 	debug.Init(cfg.Debug)
-	cfg.GetPlaylistName()
 }
 
 func main() {
 
 	cfg := config.ReadEnv()
 	setup(&cfg)
-	httpClient := initHttpClient()
-	client, err := client.NewClient(&cfg, httpClient)
-	if err != nil {
-		log.Fatal(err)
+
+	if len(os.Args) > 1 { // Run a single command, see cli.go
+		if err := runCommand(&cfg, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
-	discovery := discovery.NewDiscoverer(cfg.DiscoveryCfg, httpClient)
-	downloader := downloader.NewDownloader(&cfg.DownloadCfg, httpClient)
 
-	tracks, err := discovery.Discover()
-	if err != nil {
+	if err := run(&cfg); err != nil {
 		log.Fatal(err)
 	}
-	if !cfg.Persist {
-		err := client.DeletePlaylist()
-		if err != nil {
-			log.Println(err)
-		}
-		downloader.DeleteSongs()
+}
+
+func run(cfg *config.Config) error { // Explore once, or keep running if a schedule or HTTP address is set
+	if err := cfg.Validate(); err != nil { // fail before a run, not in the middle of it
+		return fmt.Errorf("config is not valid:\n%s", err.Error())
+	}
+	state, err := store.Open(cfg.StateFile)
+	if err != nil {
+		log.Printf("warning: %s, run history won't be saved", err.Error())
 	}
-	client.CheckTracks(tracks) // Check if tracks exist on system before downloading
-	downloader.StartDownload(&tracks)
-	if len(tracks) == 0 {
-		log.Fatal("couldn't download any tracks")
+	defer closeState(state)
+
+	explorer := app.New(cfg, initHttpClient(), state)
+	if cfg.Schedule != "" || cfg.ServerCfg.Address != "" { // Keep running, explore on schedule or when requested through the HTTP API
+		return NewDaemon(cfg, explorer).Start()
 	}
+	return explorer.Run(context.Background())
+}
 
-	if err := client.CreatePlaylist(tracks); err != nil {
-		log.Println(err)
-	} else {
-		log.Printf("[%s] %s playlist created successfully", cfg.System, cfg.ClientCfg.PlaylistName)
+func closeState(state *store.Store) {
+	if err := state.Close(); err != nil {
+		log.Printf("warning: failed to close state file: %s", err.Error())
 	}
 }
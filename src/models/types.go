@@ -4,14 +4,42 @@ package models
 
 type Track struct {
 	Album  string
-	ID string
+	AlbumArtist string
+	Year int
+	TrackNumber int
 	Artist string // All artists as returned by LB
 	MainArtist string
-	MainArtistID string
 	CleanTitle string // Title as returned by LB
 	Title  string // Title as built in listenbrainz.go
+	RecordingMBID string // MusicBrainz IDs (not available for every track)
+	ArtistMBID string // MBID of the main artist
+	ReleaseMBID string
+	ReleaseGroupMBID string
+	CoverArtMBID string // Release MBID with artwork in the Cover Art Archive
+	LibraryID string // Item ID in the music system
+	DownloadID string // YouTube video ID or slskd search ID
+	DownloadUser string // Soulseek user the file is downloaded from (slskd)
+	Downloader string // Service that downloaded the track
+	FailReason string // Why the last download attempt failed
+	Review string // Review decision: approved or rejected
+	Rejected []string // Download sources rejected during review, skipped when downloading again
 	File   string // File name
+	Path   string // Full path of the downloaded file
 	Size int // File size
 	Present bool // is track present in the system or not
 	Duration int // Track duration in milliseconds (not available for every track)
-}
\ No newline at end of file
+}
+
+
+const ( // Track review decisions
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+type Playlist struct {
+	Name string // Base name, formatted by config.GetPlaylistName before use
+	Description string
+	Period string // How often the source regenerates the playlist (daily, weekly or yearly), empty means weekly
+	User string // System user the playlist is created for, empty unless EXPLO_USERS is set
+	Tracks []*Track
+}
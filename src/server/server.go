@@ -0,0 +1,275 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"explo/src/app"
+	"explo/src/config"
+	"explo/src/store"
+)
+
+//go:embed web
+var web embed.FS
+
+// Server exposes runs of the App over HTTP
+type Server struct {
+	cfg    config.ServerConfig
+	app    *app.App
+	server *http.Server
+}
+
+type RunSummary struct {
+	ID        uint64
+	System    string
+	DryRun    bool `json:",omitempty"`
+	Expired   bool `json:",omitempty"`
+	Status    string
+	Error     string `json:",omitempty"`
+	Started   time.Time
+	Finished  time.Time
+	Playlists []string
+	Tracks    map[string]int // number of tracks per status
+}
+
+func NewServer(cfg config.ServerConfig, explorer *app.App) *Server {
+	s := &Server{
+		cfg: cfg,
+		app: explorer,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/runs", s.listRuns)
+	mux.HandleFunc("POST /api/runs", s.startRun)
+	mux.HandleFunc("GET /api/runs/current", s.currentRun)
+	mux.HandleFunc("DELETE /api/runs/current", s.cancelRun)
+	mux.HandleFunc("GET /api/runs/{id}", s.getRun)
+	mux.HandleFunc("GET /api/tracks", s.listTracks)
+	mux.HandleFunc("GET /api/review", s.getReview)
+	mux.HandleFunc("POST /api/review/tracks/{index}/{action}", s.reviewTrack)
+	mux.HandleFunc("POST /api/review/publish", s.publishReview)
+	mux.Handle("GET /", http.FileServerFS(mustSub(web, "web")))
+
+	s.server = &http.Server{
+		Addr:              cfg.Address,
+		Handler:           s.authenticate(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s
+}
+
+func (s *Server) ListenAndServe() error {
+	log.Printf("[server] listening on %s", s.cfg.Address)
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler { // require 'Authorization: Bearer <HTTP_TOKEN>' if a token is set
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.Token != "" && strings.HasPrefix(r.URL.Path, "/api/") { // the dashboard itself is static, it asks for the token
+			expected := "Bearer " + s.cfg.Token
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) != 1 {
+				writeError(w, http.StatusUnauthorized, errors.New("invalid or missing token"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) listRuns(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if param := r.URL.Query().Get("limit"); param != "" {
+		var err error
+		if limit, err = strconv.Atoi(param); err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("limit must be a positive number"))
+			return
+		}
+	}
+
+	runs, err := s.app.State.Runs(limit)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	summaries := make([]RunSummary, 0, len(runs))
+	for _, run := range runs {
+		summaries = append(summaries, summarize(run))
+	}
+	writeJSON(w, http.StatusOK, summaries)
+}
+
+func (s *Server) startRun(w http.ResponseWriter, r *http.Request) {
+	id, err := s.app.Start()
+	if errors.Is(err, app.ErrRunning) {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]uint64{"ID": id})
+}
+
+func (s *Server) currentRun(w http.ResponseWriter, r *http.Request) {
+	id, running := s.app.Current()
+	if !running {
+		writeError(w, http.StatusNotFound, errors.New("no run in progress"))
+		return
+	}
+	s.writeRun(w, id)
+}
+
+func (s *Server) cancelRun(w http.ResponseWriter, r *http.Request) {
+	if !s.app.Cancel() {
+		writeError(w, http.StatusNotFound, errors.New("no run in progress"))
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) getRun(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("invalid run ID"))
+		return
+	}
+	s.writeRun(w, id)
+}
+
+func (s *Server) listTracks(w http.ResponseWriter, r *http.Request) { // latest outcome of every track, ?status= filters by status
+	tracks, err := s.app.State.Tracks(r.URL.Query().Get("status"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tracks)
+}
+
+func (s *Server) getReview(w http.ResponseWriter, r *http.Request) {
+	review, err := s.app.Review()
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, review.View())
+}
+
+func (s *Server) reviewTrack(w http.ResponseWriter, r *http.Request) { // approve, reject or retry a track
+	review, err := s.app.Review()
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("invalid track index"))
+		return
+	}
+
+	switch action := r.PathValue("action"); action {
+	case "approve":
+		err = review.Approve(index)
+	case "reject":
+		err = review.Reject(index)
+	case "retry":
+		err = review.Retry(index)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown action '%s'", action))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, review.View())
+}
+
+func (s *Server) publishReview(w http.ResponseWriter, r *http.Request) {
+	review, err := s.app.Review()
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	review.Publish()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) writeRun(w http.ResponseWriter, id uint64) {
+	run, err := s.app.State.GetRun(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+}
+
+func summarize(run store.Run) RunSummary {
+	summary := RunSummary{
+		ID:       run.ID,
+		System:   run.System,
+		DryRun:   run.DryRun,
+		Expired:  run.Expired,
+		Status:   run.Status,
+		Error:    run.Error,
+		Started:  run.Started,
+		Finished: run.Finished,
+		Tracks:   make(map[string]int),
+	}
+	for _, playlist := range run.Playlists {
+		summary.Playlists = append(summary.Playlists, playlist.Name)
+	}
+	for _, track := range run.Tracks {
+		summary.Tracks[track.Status]++
+	}
+	return summary
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("[server] failed to write response: %s", err.Error())
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, store.ErrDisabled):
+		writeError(w, http.StatusServiceUnavailable, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func mustSub(fsys embed.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		log.Fatalf("failed to load embedded files: %s", err.Error())
+	}
+	return sub
+}
@@ -0,0 +1,368 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"explo/src/models"
+	"explo/src/util"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Track statuses, from least to most progressed
+const (
+	StatusDiscovered = "discovered" // recommended, not checked yet
+	StatusFailed     = "failed"     // not in the system and no downloader could get it
+	StatusPresent    = "present"    // already in the system
+	StatusDownloaded = "downloaded"
+	StatusRejected   = "rejected" // removed during review
+)
+
+// Run statuses
+const (
+	RunRunning  = "running"
+	RunFinished = "finished"
+	RunFailed   = "failed"
+)
+
+var (
+	ErrNotFound = errors.New("run not found")
+	ErrDisabled = errors.New("run history is disabled, STATE_FILE couldn't be opened")
+)
+
+var (
+	runsBucket   = []byte("runs")
+	tracksBucket = []byte("tracks")
+)
+
+// Store keeps the history of runs, a nil Store records nothing
+type Store struct {
+	db *bolt.DB
+}
+
+type Run struct {
+	ID        uint64
+	System    string
+	DryRun    bool `json:",omitempty"` // nothing was downloaded or changed in the system
+	Expired   bool `json:",omitempty"` // playlists and downloads were removed by the retention policy
+	Status    string
+	Error     string `json:",omitempty"`
+	Started   time.Time
+	Finished  time.Time
+	Playlists []Playlist
+	Tracks    []TrackRecord // outcome of every track in this run
+}
+
+type Playlist struct {
+	Name        string
+	Description string
+	User        string   `json:",omitempty"` // system user the playlist belongs to
+	Tracks      []string // track keys
+	Created     bool     // playlist was created in at least one system
+	Systems     []string `json:",omitempty"` // systems the playlist was created in
+}
+
+type TrackRecord struct {
+	Key           string // recording MBID, or normalized artist and title if there's none
+	RecordingMBID string `json:",omitempty"`
+	Artist        string
+	Title         string
+	Album         string `json:",omitempty"`
+	Status        string
+	Downloader    string `json:",omitempty"`
+	Path          string `json:",omitempty"` // full path of the downloaded file
+	LibraryID     string `json:",omitempty"`
+	FailReason    string `json:",omitempty"`
+	Review        string `json:",omitempty"` // approved or rejected
+	RunID         uint64 // last run the track was recommended in
+	FirstSeen     time.Time
+	LastSeen      time.Time
+}
+
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second}) // the file is locked while another instance has it open
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state file %s: %s", path, err.Error())
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{runsBucket, tracksBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to create buckets: %s", err.Error())
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+func (s *Store) StartRun(system string, dryRun bool) (*Run, error) {
+	run := &Run{
+		System:  system,
+		DryRun:  dryRun,
+		Status:  RunRunning,
+		Started: time.Now(),
+	}
+	if s == nil {
+		return run, nil
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(runsBucket)
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		run.ID = id
+		return putJSON(b, runKey(id), run)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start run: %s", err.Error())
+	}
+	return run, nil
+}
+
+func (s *Store) RecordDiscovery(run *Run, playlists []*models.Playlist) error { // save discovered playlists and their tracks
+	run.Playlists = run.Playlists[:0]
+	for _, playlist := range playlists {
+		keys := make([]string, 0, len(playlist.Tracks))
+		for _, track := range playlist.Tracks {
+			keys = append(keys, util.TrackKey(track))
+		}
+		run.Playlists = append(run.Playlists, Playlist{
+			Name:        playlist.Name,
+			Description: playlist.Description,
+			User:        playlist.User,
+			Tracks:      keys,
+		})
+	}
+
+	var tracks []*models.Track
+	for _, playlist := range playlists {
+		tracks = append(tracks, playlist.Tracks...)
+	}
+	return s.RecordTracks(run, tracks)
+}
+
+func (s *Store) RecordTracks(run *Run, tracks []*models.Track) error { // update track outcomes from the current state of tracks
+	if s == nil {
+		return nil
+	}
+	now := time.Now()
+	index := make(map[string]int, len(run.Tracks))
+	for i, record := range run.Tracks {
+		index[record.Key] = i
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(tracksBucket)
+		for _, track := range tracks {
+			key := util.TrackKey(track)
+
+			var record TrackRecord
+			if err := getJSON(b, []byte(key), &record); err != nil {
+				return err
+			}
+			if i, ok := index[key]; ok && run.DryRun { // dry runs only keep records on the run
+				record = run.Tracks[i]
+			}
+			if record.Key == "" || record.RunID != run.ID { // first time this run, previous outcome doesn't apply
+				record = TrackRecord{Key: key, FirstSeen: record.FirstSeen, Status: StatusDiscovered}
+				if record.FirstSeen.IsZero() {
+					record.FirstSeen = now
+				}
+			}
+			update(&record, track)
+			record.RunID = run.ID
+			record.LastSeen = now
+
+			if !run.DryRun { // a dry run would overwrite the outcome of the last real run
+				if err := putJSON(b, []byte(key), record); err != nil {
+					return err
+				}
+			}
+
+			if i, ok := index[key]; ok {
+				run.Tracks[i] = record
+			} else {
+				index[key] = len(run.Tracks)
+				run.Tracks = append(run.Tracks, record)
+			}
+		}
+		return putJSON(tx.Bucket(runsBucket), runKey(run.ID), run)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record tracks: %s", err.Error())
+	}
+	return nil
+}
+
+func (s *Store) RecordPlaylist(run *Run, system string, playlist *models.Playlist) error { // mark playlist as created in the system
+	for i := range run.Playlists {
+		if run.Playlists[i].Name == playlist.Name && run.Playlists[i].User == playlist.User {
+			run.Playlists[i].Created = true
+			run.Playlists[i].Systems = append(run.Playlists[i].Systems, system)
+		}
+	}
+	return s.saveRun(run)
+}
+
+func (s *Store) ExpireRun(run *Run) error { // mark run as cleaned up by the retention policy
+	run.Expired = true
+	return s.saveRun(run)
+}
+
+func (s *Store) FinishRun(run *Run, runErr error) error {
+	run.Status = RunFinished
+	if runErr != nil {
+		run.Status = RunFailed
+		run.Error = runErr.Error()
+	}
+	run.Finished = time.Now()
+	return s.saveRun(run)
+}
+
+func (s *Store) Runs(limit int) ([]Run, error) { // newest runs first, all runs if limit is 0
+	if s == nil {
+		return nil, ErrDisabled
+	}
+	var runs []Run
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(runsBucket).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var run Run
+			if err := json.Unmarshal(v, &run); err != nil {
+				return err
+			}
+			runs = append(runs, run)
+			if limit > 0 && len(runs) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read runs: %s", err.Error())
+	}
+	return runs, nil
+}
+
+func (s *Store) GetRun(id uint64) (*Run, error) {
+	if s == nil {
+		return nil, ErrDisabled
+	}
+	var run Run
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return getJSON(tx.Bucket(runsBucket), runKey(id), &run)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run %d: %s", id, err.Error())
+	}
+	if run.ID == 0 {
+		return nil, ErrNotFound
+	}
+	return &run, nil
+}
+
+func (s *Store) Tracks(status string) ([]TrackRecord, error) { // latest outcome of every known track, filtered by status if given
+	if s == nil {
+		return nil, ErrDisabled
+	}
+	var records []TrackRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(tracksBucket).ForEach(func(_, v []byte) error {
+			var record TrackRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+			if status == "" || record.Status == status {
+				records = append(records, record)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tracks: %s", err.Error())
+	}
+	return records, nil
+}
+
+func (s *Store) saveRun(run *Run) error {
+	if s == nil {
+		return nil
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(runsBucket), runKey(run.ID), run)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save run %d: %s", run.ID, err.Error())
+	}
+	return nil
+}
+
+func update(record *TrackRecord, track *models.Track) { // fields are only overwritten when set, so later stages don't erase earlier outcomes
+	record.RecordingMBID = track.RecordingMBID
+	record.Artist = track.Artist
+	record.Title = track.Title
+	record.Album = track.Album
+	if track.LibraryID != "" {
+		record.LibraryID = track.LibraryID
+	}
+
+	switch {
+	case track.Downloader != "":
+		record.Status = StatusDownloaded
+		record.Downloader = track.Downloader
+		record.Path = track.Path
+		record.FailReason = ""
+	case track.Present || track.LibraryID != "":
+		if record.Status != StatusDownloaded {
+			record.Status = StatusPresent
+		}
+	case track.FailReason != "":
+		record.Status = StatusFailed
+		record.FailReason = track.FailReason
+	}
+
+	record.Review = track.Review
+	if track.Review == models.ReviewRejected {
+		record.Status = StatusRejected
+	}
+}
+
+func runKey(id uint64) []byte { // big endian, so runs are sorted by ID
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+func putJSON(b *bolt.Bucket, key []byte, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+func getJSON(b *bolt.Bucket, key []byte, v any) error { // leaves v unchanged if key doesn't exist
+	data := b.Get(key)
+	if data == nil {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
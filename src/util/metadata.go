@@ -1,8 +1,33 @@
 package util
 
+import (
+	"regexp"
+	"strings"
+
+	"explo/src/models"
+)
+
 func Abs(x int) int { // Helper func to return absolute difference between tracks
 	if x < 0 {
 		return -x
 	}
 	return x
-}
\ No newline at end of file
+}
+
+var sanitizer = regexp.MustCompile(`[^\p{L}\d]+`)
+
+func Normalize(s string) string { // lowercase string with only letters and digits, used to match artists and titles
+	return sanitizer.ReplaceAllString(strings.ToLower(s), "")
+}
+
+func NameKey(track *models.Track) string { // normalized artist and title
+	return Normalize(track.MainArtist) + "|" + Normalize(track.CleanTitle)
+}
+
+// TrackKey identifies a track across playlists and runs
+func TrackKey(track *models.Track) string {
+	if track.RecordingMBID != "" {
+		return track.RecordingMBID
+	}
+	return NameKey(track)
+}